@@ -8,7 +8,6 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	"github.com/eliothedeman/bangarang/config"
-	"github.com/eliothedeman/bangarang/escalation"
 	"github.com/eliothedeman/bangarang/pipeline"
 	"github.com/gorilla/mux"
 )
@@ -94,8 +93,8 @@ func (p *EscalationConfig) Post(req *Request) {
 			return err
 		}
 
-		esc := &escalation.EscalationPolicy{}
-		err = json.Unmarshal(buff, esc)
+		// make sure the policy will work before the pipeline tries to use it
+		esc, err := config.ValidateEscalationPolicy(buff)
 		if err != nil {
 			return err
 		}
@@ -107,9 +106,27 @@ func (p *EscalationConfig) Post(req *Request) {
 	}, req.u)
 
 	if err != nil {
-		logrus.Error(err)
+		writeConfigError(req, err)
+	}
+
+}
+
+// writeConfigError responds with the error. Validation errors are written as json, so each
+// problem can be shown next to the field it is about
+func writeConfigError(req *Request, err error) {
+	logrus.Error(err)
+	v, ok := err.(*config.ValidationError)
+	if !ok {
 		http.Error(req.w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
+	buff, err := json.Marshal(v)
+	if err != nil {
+		http.Error(req.w, v.Error(), http.StatusBadRequest)
+		return
 	}
 
+	req.w.WriteHeader(http.StatusBadRequest)
+	req.w.Write(buff)
 }
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/eliothedeman/bangarang/event"
+	"github.com/eliothedeman/bangarang/pipeline"
+	"github.com/gorilla/mux"
+)
+
+// EscalationDelivery handles the api methods for the delivery log of an escalation policy
+type EscalationDelivery struct {
+	pipeline *pipeline.Pipeline
+}
+
+// NewEscalationDelivery Create a new EscalationDelivery api method
+func NewEscalationDelivery(pipe *pipeline.Pipeline) *EscalationDelivery {
+	return &EscalationDelivery{
+		pipeline: pipe,
+	}
+}
+
+// EndPoint return the endpoint of this method
+func (e *EscalationDelivery) EndPoint() string {
+	return "/api/escalation/{id}/deliveries"
+}
+
+// Get HTTP get method
+func (e *EscalationDelivery) Get(req *Request) {
+	vars := mux.Vars(req.r)
+	id, ok := vars["id"]
+	if !ok {
+		http.Error(req.w, "must append escalation id", http.StatusBadRequest)
+		return
+	}
+
+	// if the id is "*", fetch the deliveries for every escalation policy
+	var filter func(d *event.Delivery) bool
+	if id != "*" {
+		filter = func(d *event.Delivery) bool {
+			return d.EscalationPolicy == id
+		}
+	}
+
+	writeDeliveries(req, e.pipeline.GetIndex().ListDeliveries(filter))
+}
+
+// writeDeliveries encodes the deliveries as the response to the request
+func writeDeliveries(req *Request, ds []*event.Delivery) {
+	buff, err := json.Marshal(ds)
+	if err != nil {
+		logrus.Error(err)
+		http.Error(req.w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	req.w.Write(buff)
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/eliothedeman/bangarang/config"
+	"github.com/eliothedeman/bangarang/escalation"
+	"github.com/eliothedeman/bangarang/event"
+	"github.com/eliothedeman/bangarang/pipeline"
+	"github.com/gorilla/mux"
+)
+
+const (
+	TEST_INCIDENT_POLICY = "bangarang_test"
+	TEST_INCIDENT_TAG    = "bangarang_test"
+)
+
+// EscalationFire sends a test incident to every escalation of an escalation policy
+type EscalationFire struct {
+	pipeline *pipeline.Pipeline
+}
+
+// NewEscalationFire Create a new EscalationFire api method
+func NewEscalationFire(pipe *pipeline.Pipeline) *EscalationFire {
+	return &EscalationFire{
+		pipeline: pipe,
+	}
+}
+
+// EndPoint return the endpoint of this method
+func (e *EscalationFire) EndPoint() string {
+	return "/api/escalation/config/{id}/test"
+}
+
+// testIncident describes the incident to send. Every field is optional
+type testIncident struct {
+	Tags        *event.TagSet `json:"tags"`
+	Status      *int          `json:"status"`
+	Metric      float64       `json:"metric"`
+	Policy      string        `json:"policy"`
+	Description string        `json:"description"`
+}
+
+// newIncident creates the synthetic incident
+func (t *testIncident) newIncident(id string) *event.Incident {
+	e := event.NewEvent()
+	t.Tags.ForEach(func(k, v string) {
+		e.Tags.Set(k, v)
+	})
+
+	// let the receiver know this isn't real
+	e.Tags.Set(TEST_INCIDENT_TAG, "true")
+	e.Metric = t.Metric
+
+	status := event.CRITICAL
+	if t.Status != nil {
+		status = *t.Status
+	}
+
+	policy := t.Policy
+	if policy == "" {
+		policy = TEST_INCIDENT_POLICY
+	}
+
+	i := event.NewIncident(policy, status, e)
+	i.Description = t.Description
+	if i.Description == "" {
+		i.Description = fmt.Sprintf("Test incident for escalation policy %s", id)
+	}
+
+	return i
+}
+
+// Post sends the test incident followed by its resolution, and responds with the outcome of each attempt
+func (e *EscalationFire) Post(req *Request) {
+	vars := mux.Vars(req.r)
+	id, ok := vars["id"]
+	if !ok {
+		http.Error(req.w, "must append escalation id", http.StatusBadRequest)
+		return
+	}
+
+	t := &testIncident{}
+	buff, err := ioutil.ReadAll(req.r.Body)
+	if err != nil {
+		logrus.Error(err)
+		http.Error(req.w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// an empty body sends the default incident
+	if len(buff) > 0 {
+		err = json.Unmarshal(buff, t)
+		if err != nil {
+			logrus.Error(err)
+			http.Error(req.w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var esc *escalation.EscalationPolicy
+	e.pipeline.ViewConfig(func(conf *config.AppConfig) {
+		esc = conf.Escalations[id]
+	})
+
+	if esc == nil {
+		http.Error(req.w, fmt.Sprintf("Unable to find escalation '%s'", id), http.StatusNotFound)
+		return
+	}
+
+	logrus.Infof("Sending test incident to escalation %s", id)
+	i := t.newIncident(id)
+	ds := esc.Test(i)
+
+	// resolve the test incident right away, so escalations that keep track of open incidents forget about it
+	if i.Status != event.OK {
+		ok := event.OK
+		t.Status = &ok
+		ds = append(ds, esc.Test(t.newIncident(id))...)
+	}
+
+	for _, d := range ds {
+		d.EscalationPolicy = id
+	}
+
+	writeDeliveries(req, ds)
+}
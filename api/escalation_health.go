@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/eliothedeman/bangarang/config"
+	"github.com/eliothedeman/bangarang/escalation"
+	"github.com/eliothedeman/bangarang/pipeline"
+	"github.com/gorilla/mux"
+)
+
+// EscalationHealth handles the api methods for the health of the escalations of an escalation policy
+type EscalationHealth struct {
+	pipeline *pipeline.Pipeline
+}
+
+// NewEscalationHealth Create a new EscalationHealth api method
+func NewEscalationHealth(pipe *pipeline.Pipeline) *EscalationHealth {
+	return &EscalationHealth{
+		pipeline: pipe,
+	}
+}
+
+// EndPoint return the endpoint of this method
+func (e *EscalationHealth) EndPoint() string {
+	return "/api/escalation/{id}/health"
+}
+
+// Get HTTP get method
+func (e *EscalationHealth) Get(req *Request) {
+	vars := mux.Vars(req.r)
+	id, ok := vars["id"]
+	if !ok {
+		http.Error(req.w, "must append escalation id", http.StatusBadRequest)
+		return
+	}
+
+	var escs map[string]*escalation.EscalationPolicy
+	e.pipeline.ViewConfig(func(conf *config.AppConfig) {
+		escs = conf.Escalations
+	})
+
+	// if the id is "*", fetch the health of every escalation policy
+	var res interface{}
+	if id == "*" {
+		all := make(map[string][]*escalation.Health, len(escs))
+		for name, esc := range escs {
+			all[name] = esc.Health()
+		}
+		res = all
+	} else {
+		esc, ok := escs[id]
+		if !ok {
+			http.Error(req.w, fmt.Sprintf("Unable to find escalation '%s'", id), http.StatusNotFound)
+			return
+		}
+		res = esc.Health()
+	}
+
+	buff, err := json.Marshal(res)
+	if err != nil {
+		logrus.Error(err)
+		http.Error(req.w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	req.w.Write(buff)
+}
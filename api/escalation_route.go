@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/eliothedeman/bangarang/config"
+	"github.com/eliothedeman/bangarang/escalation"
+	"github.com/eliothedeman/bangarang/pipeline"
+)
+
+// EscalationRoute handles the api methods for the escalation routing tree
+type EscalationRoute struct {
+	pipeline *pipeline.Pipeline
+}
+
+// NewEscalationRoute Create a new EscalationRoute api method
+func NewEscalationRoute(pipe *pipeline.Pipeline) *EscalationRoute {
+	return &EscalationRoute{
+		pipeline: pipe,
+	}
+}
+
+// EndPoint return the endpoint of this method
+func (e *EscalationRoute) EndPoint() string {
+	return "/api/escalation/route"
+}
+
+// Get HTTP get method
+func (e *EscalationRoute) Get(req *Request) {
+	var route *escalation.Route
+	e.pipeline.ViewConfig(func(conf *config.AppConfig) {
+		route = conf.Route
+	})
+
+	buff, err := json.Marshal(route)
+	if err != nil {
+		logrus.Error(err)
+		http.Error(req.w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	req.w.Write(buff)
+}
+
+// Post replaces the routing tree
+func (e *EscalationRoute) Post(req *Request) {
+	err := e.pipeline.UpdateConfig(func(conf *config.AppConfig) error {
+		buff, err := ioutil.ReadAll(req.r.Body)
+		if err != nil {
+			return err
+		}
+
+		route := &escalation.Route{}
+		err = json.Unmarshal(buff, route)
+		if err != nil {
+			return err
+		}
+
+		// make sure the tree is valid before the pipeline uses it
+		err = route.Compile()
+		if err != nil {
+			return err
+		}
+
+		conf.Route = route
+		return nil
+	}, req.u)
+
+	if err != nil {
+		logrus.Error(err)
+		http.Error(req.w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// Delete removes the routing tree, so incidents are sent to every escalation
+func (e *EscalationRoute) Delete(req *Request) {
+	err := e.pipeline.UpdateConfig(func(conf *config.AppConfig) error {
+		conf.Route = nil
+		return nil
+	}, req.u)
+
+	if err != nil {
+		logrus.Error(err)
+		http.Error(req.w, err.Error(), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/eliothedeman/bangarang/event"
+	"github.com/eliothedeman/bangarang/pipeline"
+)
+
+// EscalationRouteMatch shows which routes an incident with the given tags would be sent to
+type EscalationRouteMatch struct {
+	pipeline *pipeline.Pipeline
+}
+
+// NewEscalationRouteMatch Create a new EscalationRouteMatch api method
+func NewEscalationRouteMatch(pipe *pipeline.Pipeline) *EscalationRouteMatch {
+	return &EscalationRouteMatch{
+		pipeline: pipe,
+	}
+}
+
+// EndPoint return the endpoint of this method
+func (e *EscalationRouteMatch) EndPoint() string {
+	return "/api/escalation/route/match"
+}
+
+// routeMatch describes a route that was hit
+type routeMatch struct {
+	Route          string   `json:"route"`
+	Escalations    []string `json:"escalations"`
+	GroupBy        []string `json:"group_by"`
+	RepeatInterval string   `json:"repeat_interval"`
+}
+
+// Get HTTP get method. The tags of the incident are given as query parameters
+func (e *EscalationRouteMatch) Get(req *Request) {
+	tags := event.NewTagset(0)
+	for k, vs := range req.r.URL.Query() {
+		for _, v := range vs {
+			tags.Set(k, v)
+		}
+	}
+	tags.SortByKey()
+
+	route := e.pipeline.GetRoute()
+	if route == nil {
+		http.Error(req.w, "No escalation routes are configured, incidents are sent to every escalation", http.StatusNotFound)
+		return
+	}
+
+	found := route.Find(tags)
+	ms := make([]*routeMatch, 0, len(found))
+	for _, r := range found {
+		groupBy, interval := r.Grouping()
+		m := &routeMatch{
+			Route:       r.ID(),
+			Escalations: r.Targets(),
+			GroupBy:     groupBy,
+		}
+
+		if interval > 0 {
+			m.RepeatInterval = interval.String()
+		}
+
+		ms = append(ms, m)
+	}
+
+	buff, err := json.Marshal(ms)
+	if err != nil {
+		logrus.Error(err)
+		http.Error(req.w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	req.w.Write(buff)
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/eliothedeman/bangarang/config"
+	"github.com/eliothedeman/bangarang/pipeline"
+)
+
+// EscalationType lists every loaded escalation type, along with the json schema of its config
+type EscalationType struct {
+	pipeline *pipeline.Pipeline
+}
+
+// NewEscalationType Create a new EscalationType api method
+func NewEscalationType(pipe *pipeline.Pipeline) *EscalationType {
+	return &EscalationType{
+		pipeline: pipe,
+	}
+}
+
+// EndPoint return the endpoint of this method
+func (e *EscalationType) EndPoint() string {
+	return "/api/escalation/types"
+}
+
+// Get HTTP get method
+func (e *EscalationType) Get(req *Request) {
+	buff, err := json.Marshal(config.EscalationSchemas())
+	if err != nil {
+		logrus.Error(err)
+		http.Error(req.w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	req.w.Write(buff)
+}
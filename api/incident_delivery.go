@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/eliothedeman/bangarang/event"
+	"github.com/eliothedeman/bangarang/pipeline"
+	"github.com/gorilla/mux"
+)
+
+// IncidentDelivery handles the api methods for the delivery history of an incident
+type IncidentDelivery struct {
+	pipeline *pipeline.Pipeline
+}
+
+// NewIncidentDelivery Create a new IncidentDelivery api method
+func NewIncidentDelivery(pipe *pipeline.Pipeline) *IncidentDelivery {
+	return &IncidentDelivery{
+		pipeline: pipe,
+	}
+}
+
+// EndPoint return the endpoint of this method
+func (i *IncidentDelivery) EndPoint() string {
+	return "/api/incident/{id}/deliveries"
+}
+
+// Get HTTP get method
+func (i *IncidentDelivery) Get(req *Request) {
+	vars := mux.Vars(req.r)
+	id, ok := vars["id"]
+	if !ok {
+		http.Error(req.w, "Must append incident id", http.StatusBadRequest)
+		return
+	}
+
+	writeDeliveries(req, i.pipeline.GetIndex().ListDeliveries(func(d *event.Delivery) bool {
+		return d.Incident == id
+	}))
+}
@@ -128,6 +128,11 @@ func (p *PolicyConfig) Post(req *Request) {
 			pol.Name = id
 		}
 
+		err = pol.Validate()
+		if err != nil {
+			return err
+		}
+
 		pol.Compile(p.pipeline)
 		if conf.Policies == nil {
 			conf.Policies = make(map[string]*escalation.Policy)
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -28,8 +29,24 @@ func (c *ProviderConfig) EndPoint() string {
 	return "/api/provider/config/{id}"
 }
 
+// withStatus adds the running state of the provider to its config, if it has been started
+func withStatus(raw json.RawMessage, statuses map[string]provider.Status, name string) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	err := json.Unmarshal(raw, &m)
+	if err != nil {
+		return nil, err
+	}
+
+	if s, ok := statuses[name]; ok {
+		m["status"] = s
+	}
+
+	return m, nil
+}
+
 // Get HTTP get method
 func (c *ProviderConfig) Get(req *Request) {
+	statuses := c.pipeline.ProviderStatus()
 	c.pipeline.ViewConfig(func(cfg *config.AppConfig) {
 		confs := cfg.EventProviders.Raw()
 		vars := mux.Vars(req.r)
@@ -39,24 +56,45 @@ func (c *ProviderConfig) Get(req *Request) {
 			return
 		}
 
+		var res interface{}
+
 		// if the provider is "*" fetch all configs
 		if id == "*" {
-			buff, err := cfg.EventProviders.MarshalJSON()
+			all := make(map[string]map[string]interface{}, len(confs))
+			for name, raw := range confs {
+				m, err := withStatus(raw, statuses, name)
+				if err != nil {
+					logrus.Error(err)
+					http.Error(req.w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				all[name] = m
+			}
+			res = all
+		} else {
+			conf, ok := confs[id]
+			if !ok {
+				http.Error(req.w, fmt.Sprintf("Unknown event provider %s", id), http.StatusBadRequest)
+				return
+			}
+
+			m, err := withStatus(conf, statuses, id)
 			if err != nil {
 				logrus.Error(err)
 				http.Error(req.w, err.Error(), http.StatusInternalServerError)
+				return
 			}
-			req.w.Write(buff)
-			return
+			res = m
 		}
 
-		conf, ok := confs[id]
-		if !ok {
-			http.Error(req.w, fmt.Sprintf("Unknown event provider %s", id), http.StatusBadRequest)
+		buff, err := json.Marshal(res)
+		if err != nil {
+			logrus.Error(err)
+			http.Error(req.w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		req.w.Write(conf)
+		req.w.Write(buff)
 	})
 }
 
@@ -103,7 +141,8 @@ func (c *ProviderConfig) Post(req *Request) {
 			return err
 		}
 
-		ep, err := provider.ParseProvider(buff)
+		// make sure the provider will work before the pipeline tries to start it
+		ep, err := config.ValidateProvider(buff)
 		if err != nil {
 			return err
 		}
@@ -119,8 +158,7 @@ func (c *ProviderConfig) Post(req *Request) {
 	}, req.u)
 
 	if err != nil {
-		logrus.Error(err)
-		http.Error(req.w, err.Error(), http.StatusBadRequest)
+		writeConfigError(req, err)
 		return
 	}
 
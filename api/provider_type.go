@@ -0,0 +1,39 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/eliothedeman/bangarang/config"
+	"github.com/eliothedeman/bangarang/pipeline"
+)
+
+// ProviderType lists every loaded event provider type, along with the json schema of its config
+type ProviderType struct {
+	pipeline *pipeline.Pipeline
+}
+
+// NewProviderType Create a new ProviderType api method
+func NewProviderType(pipe *pipeline.Pipeline) *ProviderType {
+	return &ProviderType{
+		pipeline: pipe,
+	}
+}
+
+// EndPoint return the endpoint of this method
+func (e *ProviderType) EndPoint() string {
+	return "/api/provider/types"
+}
+
+// Get HTTP get method
+func (e *ProviderType) Get(req *Request) {
+	buff, err := json.Marshal(config.ProviderSchemas())
+	if err != nil {
+		logrus.Error(err)
+		http.Error(req.w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	req.w.Write(buff)
+}
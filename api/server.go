@@ -248,9 +248,17 @@ func NewServer(port int, pipe *pipeline.Pipeline) *Server {
 	s.construct(NewConfigHash(pipe))
 	s.construct(NewEventStats(pipe))
 	s.construct(NewProviderConfig(pipe))
+	s.construct(NewProviderType(pipe))
 	s.construct(NewPolicyConfig(pipe))
 	s.construct(NewConfigVersion(pipe))
 	s.construct(NewEscalationConfig(pipe))
+	s.construct(NewEscalationFire(pipe))
+	s.construct(NewEscalationType(pipe))
+	s.construct(NewEscalationDelivery(pipe))
+	s.construct(NewEscalationHealth(pipe))
+	s.construct(NewEscalationRoute(pipe))
+	s.construct(NewEscalationRouteMatch(pipe))
+	s.construct(NewIncidentDelivery(pipe))
 	s.construct(NewTag(pipe))
 	s.construct(NewAuthUser(pipe))
 	s.construct(NewUser(pipe))
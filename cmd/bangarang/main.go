@@ -13,13 +13,25 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/eliothedeman/bangarang/api"
 	"github.com/eliothedeman/bangarang/config"
+	_ "github.com/eliothedeman/bangarang/escalation/alertmanager"
 	_ "github.com/eliothedeman/bangarang/escalation/console"
 	_ "github.com/eliothedeman/bangarang/escalation/email"
+	_ "github.com/eliothedeman/bangarang/escalation/exec"
 	_ "github.com/eliothedeman/bangarang/escalation/grafana-graphite-annotation"
 	_ "github.com/eliothedeman/bangarang/escalation/pd"
+	_ "github.com/eliothedeman/bangarang/escalation/slack"
+	_ "github.com/eliothedeman/bangarang/escalation/webhook"
 	"github.com/eliothedeman/bangarang/pipeline"
+	_ "github.com/eliothedeman/bangarang/provider/file"
+	_ "github.com/eliothedeman/bangarang/provider/graphite"
 	_ "github.com/eliothedeman/bangarang/provider/http"
+	_ "github.com/eliothedeman/bangarang/provider/influx"
+	_ "github.com/eliothedeman/bangarang/provider/prometheus"
+	_ "github.com/eliothedeman/bangarang/provider/statsd"
+	_ "github.com/eliothedeman/bangarang/provider/syslog"
 	_ "github.com/eliothedeman/bangarang/provider/tcp"
+	_ "github.com/eliothedeman/bangarang/provider/udp"
+	_ "github.com/eliothedeman/bangarang/provider/unix"
 )
 
 var (
@@ -69,6 +69,7 @@ type AppConfig struct {
 	RawKeepAliveAge string                                  `json:"keep_alive_age"`
 	DbPath          string                                  `json:"db_path"`
 	Escalations     map[string]*escalation.EscalationPolicy `json:"escalations"`
+	Route           *escalation.Route                       `json:"route"`
 	Encoding        string                                  `json:"encoding"`
 	Policies        map[string]*escalation.Policy           `json:"policies"`
 	EventProviders  *provider.EventProviderCollection       `json:"event_providers"`
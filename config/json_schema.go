@@ -0,0 +1,196 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/eliothedeman/bangarang/escalation"
+	"github.com/eliothedeman/bangarang/provider"
+)
+
+const (
+	// struct tag options for config fields, `schema:"required,secret"`
+	SCHEMA_TAG      = "schema"
+	SCHEMA_REQUIRED = "required"
+	SCHEMA_SECRET   = "secret"
+)
+
+// JSONSchema describes the config of an escalation or provider type, so a form can be built for it
+type JSONSchema struct {
+	Type                 string                 `json:"type,omitempty"`
+	Const                interface{}            `json:"const,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	AdditionalProperties *JSONSchema            `json:"additionalProperties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	Default              interface{}            `json:"default,omitempty"`
+
+	// secrets should be hidden when they are shown, so they have no default
+	Secret bool `json:"secret,omitempty"`
+}
+
+// SchemaFor creates a schema from a config struct. Any values already set in the struct are used as the defaults
+func SchemaFor(conf interface{}) *JSONSchema {
+	if conf == nil {
+		return &JSONSchema{
+			Type: "object",
+		}
+	}
+
+	return schemaForValue(reflect.ValueOf(conf))
+}
+
+func schemaForValue(v reflect.Value) *JSONSchema {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return schemaForType(v.Type())
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() == reflect.Struct {
+		s := &JSONSchema{Type: "object"}
+		addProperties(s, v)
+		return s
+	}
+
+	s := schemaForType(v.Type())
+	if !isZero(v) {
+		s.Default = v.Interface()
+	}
+
+	return s
+}
+
+// schemaForType creates a schema without defaults
+func schemaForType(t reflect.Type) *JSONSchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &JSONSchema{
+			Type:  "array",
+			Items: schemaForType(t.Elem()),
+		}
+	case reflect.Map:
+		return &JSONSchema{
+			Type:                 "object",
+			AdditionalProperties: schemaForType(t.Elem()),
+		}
+	case reflect.Struct:
+		s := &JSONSchema{Type: "object"}
+		addProperties(s, reflect.New(t).Elem())
+		return s
+	}
+
+	// anything goes
+	return &JSONSchema{}
+}
+
+// addProperties adds every field of the struct that is encoded as json to the schema
+func addProperties(s *JSONSchema, v reflect.Value) {
+	if s.Properties == nil {
+		s.Properties = make(map[string]*JSONSchema)
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		// embedded structs are flattened, the same as in encoding/json
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			addProperties(s, v.Field(i))
+			continue
+		}
+
+		if f.PkgPath != "" {
+			continue
+		}
+
+		name := f.Name
+		if tag := f.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+
+			if n := strings.Split(tag, ",")[0]; n != "" {
+				name = n
+			}
+		}
+
+		p := schemaForValue(v.Field(i))
+		for _, opt := range strings.Split(f.Tag.Get(SCHEMA_TAG), ",") {
+			switch opt {
+			case SCHEMA_REQUIRED:
+				s.Required = append(s.Required, name)
+			case SCHEMA_SECRET:
+				p.Secret = true
+				p.Default = nil
+			}
+		}
+
+		s.Properties[name] = p
+	}
+}
+
+// isZero returns true if the value is the zero value of its type, or an empty collection
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+
+	return v.IsZero()
+}
+
+// withType adds the "type" field every plugin config has, fixed to the given type name
+func withType(s *JSONSchema, name string) *JSONSchema {
+	if s.Properties == nil {
+		s.Properties = make(map[string]*JSONSchema)
+	}
+
+	s.Properties["type"] = &JSONSchema{
+		Type:  "string",
+		Const: name,
+	}
+	s.Required = append([]string{"type"}, s.Required...)
+	return s
+}
+
+// EscalationSchemas returns the schema of every loaded escalation type, by type name
+func EscalationSchemas() map[string]*JSONSchema {
+	schemas := make(map[string]*JSONSchema)
+	for _, name := range escalation.Types() {
+		s := withType(SchemaFor(escalation.GetFactory(name)().ConfigStruct()), name)
+
+		// every escalation can be given a name to tell it apart in the delivery log
+		s.Properties["name"] = &JSONSchema{
+			Type: "string",
+		}
+
+		schemas[name] = s
+	}
+
+	return schemas
+}
+
+// ProviderSchemas returns the schema of every loaded event provider type, by type name
+func ProviderSchemas() map[string]*JSONSchema {
+	schemas := make(map[string]*JSONSchema, len(provider.EVENT_PROVIDER_FACTORIES))
+	for name := range provider.EVENT_PROVIDER_FACTORIES {
+		schemas[name] = withType(SchemaFor(provider.GetEventProvider(name).ConfigStruct()), name)
+	}
+
+	return schemas
+}
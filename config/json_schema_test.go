@@ -0,0 +1,88 @@
+package config
+
+import (
+	"testing"
+
+	_ "github.com/eliothedeman/bangarang/escalation/webhook"
+	_ "github.com/eliothedeman/bangarang/provider/tcp"
+)
+
+type testEmbedded struct {
+	Port int `json:"port"`
+}
+
+type testConfig struct {
+	testEmbedded
+	Host     string            `json:"host" schema:"required"`
+	Password string            `json:"password" schema:"secret"`
+	Tags     []string          `json:"tags"`
+	Headers  map[string]string `json:"headers"`
+	Ratio    float64           `json:"ratio"`
+	Enabled  bool
+	Ignored  string `json:"-"`
+	hidden   string
+}
+
+func TestSchemaFor(t *testing.T) {
+	s := SchemaFor(&testConfig{
+		testEmbedded: testEmbedded{
+			Port: 80,
+		},
+		Password: "hunter2",
+	})
+
+	if s.Type != "object" || len(s.Properties) != 7 {
+		t.Fatal(s.Properties)
+	}
+
+	types := map[string]string{
+		"port":     "integer",
+		"host":     "string",
+		"password": "string",
+		"tags":     "array",
+		"headers":  "object",
+		"ratio":    "number",
+		"Enabled":  "boolean",
+	}
+	for k, v := range types {
+		if s.Properties[k] == nil || s.Properties[k].Type != v {
+			t.Errorf("%s: expected %s got %+v", k, v, s.Properties[k])
+		}
+	}
+
+	if s.Properties["port"].Default != 80 {
+		t.Error(s.Properties["port"].Default)
+	}
+
+	if !s.Properties["password"].Secret || s.Properties["password"].Default != nil {
+		t.Error(s.Properties["password"])
+	}
+
+	if len(s.Required) != 1 || s.Required[0] != "host" {
+		t.Error(s.Required)
+	}
+
+	if s.Properties["tags"].Items.Type != "string" || s.Properties["headers"].AdditionalProperties.Type != "string" {
+		t.Error(s.Properties["tags"], s.Properties["headers"])
+	}
+}
+
+func TestPluginSchemas(t *testing.T) {
+	w, ok := EscalationSchemas()["webhook"]
+	if !ok {
+		t.Fatal("The webhook escalation should be listed")
+	}
+
+	if w.Properties["type"].Const != "webhook" || w.Properties["method"].Default != "POST" {
+		t.Error(w.Properties["type"], w.Properties["method"])
+	}
+
+	if len(w.Required) != 2 || w.Required[0] != "type" || w.Required[1] != "url" {
+		t.Error(w.Required)
+	}
+
+	tcp, ok := ProviderSchemas()["tcp"]
+	if !ok || tcp.Properties["listen"] == nil {
+		t.Error(tcp)
+	}
+}
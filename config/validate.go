@@ -0,0 +1,182 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/eliothedeman/bangarang/escalation"
+	"github.com/eliothedeman/bangarang/provider"
+)
+
+// FieldError is a problem with a single field of a config. An empty field means the whole config
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError holds every problem found with a config
+type ValidationError struct {
+	Errors []*FieldError `json:"errors"`
+}
+
+func (v *ValidationError) Error() string {
+	msgs := make([]string, len(v.Errors))
+	for i, f := range v.Errors {
+		if f.Field == "" {
+			msgs[i] = f.Message
+		} else {
+			msgs[i] = fmt.Sprintf("%s: %s", f.Field, f.Message)
+		}
+	}
+
+	return strings.Join(msgs, ", ")
+}
+
+// add records the error against the field. Errors from decoding json are recorded against the field that failed
+func (v *ValidationError) add(field string, err error) {
+	if t, ok := err.(*json.UnmarshalTypeError); ok {
+		err = fmt.Errorf("Expecting %s not %s", t.Type, t.Value)
+		field = joinField(field, t.Field)
+	}
+
+	v.Errors = append(v.Errors, &FieldError{
+		Field:   field,
+		Message: err.Error(),
+	})
+}
+
+// orNil returns nil if no problems were found, so the result can be returned as an error
+func (v *ValidationError) orNil() error {
+	if len(v.Errors) == 0 {
+		return nil
+	}
+
+	return v
+}
+
+// joinField creates the path to a nested field
+func joinField(parent, field string) string {
+	if parent == "" {
+		return field
+	}
+
+	if field == "" {
+		return parent
+	}
+
+	return parent + "." + field
+}
+
+// ValidateEscalationPolicy parses the escalation policy and checks every one of its escalations
+// without starting them, returning a *ValidationError if anything is wrong
+func ValidateEscalationPolicy(buff []byte) (*escalation.EscalationPolicy, error) {
+	v := &ValidationError{}
+	esc := &escalation.EscalationPolicy{}
+	err := json.Unmarshal(buff, esc)
+	if err != nil {
+		v.add("", err)
+		return nil, v
+	}
+
+	if esc.Match != nil {
+		_, err = escalation.MatcherFromTagSet(esc.Match)
+		if err != nil {
+			v.add("match", err)
+		}
+	}
+
+	if esc.NotMatch != nil {
+		_, err = escalation.MatcherFromTagSet(esc.NotMatch)
+		if err != nil {
+			v.add("not_match", err)
+		}
+	}
+
+	for i, w := range esc.ActiveTimes {
+		err = w.Compile()
+		if err != nil {
+			v.add(fmt.Sprintf("active_times.%d", i), err)
+		}
+	}
+
+	for i, raw := range esc.Configs {
+		validateEscalation(v, fmt.Sprintf("configs.%d", i), raw)
+	}
+
+	return esc, v.orNil()
+}
+
+// validateEscalation checks a single escalation config
+func validateEscalation(v *ValidationError, field string, raw json.RawMessage) {
+	typer := struct {
+		Type string `json:"type"`
+	}{}
+
+	err := json.Unmarshal(raw, &typer)
+	if err != nil {
+		v.add(field, err)
+		return
+	}
+
+	f := escalation.GetFactory(typer.Type)
+	if f == nil {
+		v.add(joinField(field, "type"), escalation.UnknownEscalationType(typer.Type))
+		return
+	}
+
+	e := f()
+	conf := e.ConfigStruct()
+	err = json.Unmarshal(raw, conf)
+	if err != nil {
+		v.add(field, err)
+		return
+	}
+
+	// escalations don't do any work until they are started, so they can be initialized safely
+	err = e.Init(conf)
+	if err != nil {
+		v.add(field, err)
+	}
+}
+
+// ValidateProvider parses the event provider config, returning a *ValidationError if anything is wrong.
+// Providers only start work when they are started, so the initialized provider can be used as is
+func ValidateProvider(buff []byte) (provider.EventProvider, error) {
+	v := &ValidationError{}
+	typer := struct {
+		Type string `json:"type"`
+	}{}
+
+	err := json.Unmarshal(buff, &typer)
+	if err != nil {
+		v.add("", err)
+		return nil, v
+	}
+
+	if typer.Type == "" {
+		v.add("type", provider.PROVIDER_TYPE_NOT_FOUND)
+		return nil, v
+	}
+
+	p := provider.GetEventProvider(typer.Type)
+	if p == nil {
+		v.add("type", provider.INVALID_PROVIDER_TYPE(typer.Type))
+		return nil, v
+	}
+
+	conf := p.ConfigStruct()
+	err = json.Unmarshal(buff, conf)
+	if err != nil {
+		v.add("", err)
+		return nil, v
+	}
+
+	err = p.Init(conf)
+	if err != nil {
+		v.add("", err)
+		return nil, v
+	}
+
+	return p, nil
+}
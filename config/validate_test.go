@@ -0,0 +1,80 @@
+package config
+
+import (
+	"testing"
+
+	_ "github.com/eliothedeman/bangarang/escalation/webhook"
+	_ "github.com/eliothedeman/bangarang/provider/tcp"
+)
+
+func fields(err error) []string {
+	v, ok := err.(*ValidationError)
+	if !ok {
+		return nil
+	}
+
+	f := make([]string, len(v.Errors))
+	for i, e := range v.Errors {
+		f[i] = e.Field
+	}
+	return f
+}
+
+func TestValidateEscalationPolicy(t *testing.T) {
+	esc, err := ValidateEscalationPolicy([]byte(`{"crit": true, "configs": [{"type": "webhook", "url": "http://localhost"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !esc.Crit || len(esc.Configs) != 1 {
+		t.Error(esc)
+	}
+}
+
+func TestValidateEscalationPolicyErrors(t *testing.T) {
+	tests := []struct {
+		raw    string
+		fields []string
+	}{
+		{`{"configs": [{"type": "nothing"}]}`, []string{"configs.0.type"}},
+		{`{"configs": [{"type": "webhook", "url": "http://localhost"}, {"type": "webhook", "timeout": 10}]}`, []string{"configs.1.timeout"}},
+		{`{"configs": [{"type": "webhook"}]}`, []string{"configs.0"}},
+		{`{"match": [{"key": "host", "value": "("}], "active_times": [{"start": "noon"}]}`, []string{"match", "active_times.0"}},
+		{`{"crit": "yes"}`, []string{"crit"}},
+	}
+
+	for _, test := range tests {
+		_, err := ValidateEscalationPolicy([]byte(test.raw))
+		f := fields(err)
+		if len(f) != len(test.fields) {
+			t.Errorf("%s: expected %v got %v", test.raw, test.fields, err)
+			continue
+		}
+
+		for i := range f {
+			if f[i] != test.fields[i] {
+				t.Errorf("%s: expected %v got %v", test.raw, test.fields, f)
+			}
+		}
+	}
+}
+
+func TestValidateProvider(t *testing.T) {
+	p, err := ValidateProvider([]byte(`{"type": "tcp", "listen": "localhost:5555"}`))
+	if err != nil || p == nil {
+		t.Error(err)
+	}
+
+	for raw, field := range map[string]string{
+		`{"listen": "localhost:5555"}`:                   "type",
+		`{"type": "nothing"}`:                            "type",
+		`{"type": "tcp", "listen": 5555}`:                "listen",
+		`{"type": "tcp", "listen": "localhost:nothing"}`: "",
+	} {
+		_, err := ValidateProvider([]byte(raw))
+		f := fields(err)
+		if len(f) != 1 || f[0] != field {
+			t.Errorf("%s: expected %s got %v", raw, field, f)
+		}
+	}
+}
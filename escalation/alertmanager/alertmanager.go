@@ -0,0 +1,303 @@
+package alertmanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/eliothedeman/bangarang/escalation"
+	"github.com/eliothedeman/bangarang/event"
+)
+
+const (
+	ALERTS_ENDPOINT         = "/api/v2/alerts"
+	DEFAULT_RESEND_INTERVAL = "1m"
+	DEFAULT_TIMEOUT         = "10s"
+
+	// active alerts expire in alertmanager after this many missed resends
+	EXPIRE_AFTER_RESENDS = 4
+
+	// the most of a failed response body that will be included in an error
+	MAX_ERROR_BODY = 512
+)
+
+func init() {
+	escalation.LoadFactory("alertmanager", NewAlertmanager)
+}
+
+// Alert is an alert in the alertmanager v2 api format
+type Alert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+// Alertmanager forwards incidents as alerts to alertmanager compatible receivers, and re-posts
+// active alerts so they don't expire while the incident is still open
+type Alertmanager struct {
+	conf     *AlertmanagerConfig
+	client   *http.Client
+	interval time.Duration
+
+	// maps an incident's index name to the alert currently active for it
+	active  map[string]*Alert
+	lastErr error
+	stop    chan struct{}
+	done    chan struct{}
+	sync.Mutex
+}
+
+// AlertmanagerConfig holds the options for the alertmanager escalation
+type AlertmanagerConfig struct {
+	URLs           []string `json:"urls" schema:"required"`
+	ResendInterval string   `json:"resend_interval"`
+	Timeout        string   `json:"timeout"`
+	GeneratorURL   string   `json:"generator_url"`
+}
+
+func NewAlertmanager() escalation.Escalation {
+	return &Alertmanager{
+		active: make(map[string]*Alert),
+	}
+}
+
+func (a *Alertmanager) ConfigStruct() interface{} {
+	return &AlertmanagerConfig{
+		ResendInterval: DEFAULT_RESEND_INTERVAL,
+		Timeout:        DEFAULT_TIMEOUT,
+	}
+}
+
+func (a *Alertmanager) Init(i interface{}) error {
+	logrus.Info("Initializing alertmanager escalation")
+	c, ok := i.(*AlertmanagerConfig)
+	if !ok {
+		return fmt.Errorf("Incorrect config type. Expecting AlertmanagerConfig not %+v", i)
+	}
+
+	if len(c.URLs) == 0 {
+		return fmt.Errorf("At least one alertmanager url must be provided")
+	}
+
+	interval, err := time.ParseDuration(c.ResendInterval)
+	if err != nil {
+		return err
+	}
+
+	if interval <= 0 {
+		return fmt.Errorf("The resend_interval must be greater than 0")
+	}
+
+	timeout, err := time.ParseDuration(c.Timeout)
+	if err != nil {
+		return err
+	}
+
+	a.conf = c
+	a.interval = interval
+	a.client = &http.Client{
+		Timeout: timeout,
+	}
+
+	return nil
+}
+
+// newAlert converts an incident into an alert
+func (a *Alertmanager) newAlert(i *event.Incident) *Alert {
+	al := &Alert{
+		Labels: map[string]string{
+			"alertname": i.Policy,
+			"severity":  event.Status(i.Status),
+		},
+		Annotations: map[string]string{
+			"description": i.Description,
+			"summary":     i.FormatDescription(),
+		},
+		StartsAt:     time.Unix(i.Time, 0).UTC(),
+		GeneratorURL: a.conf.GeneratorURL,
+	}
+
+	i.Tags.ForEach(func(k, v string) {
+		al.Labels[k] = v
+	})
+
+	for k, v := range i.Annotations {
+		al.Annotations[k] = v
+	}
+
+	return al
+}
+
+// expiry returns the time an active alert will expire if it isn't sent again
+func (a *Alertmanager) expiry() time.Time {
+	return time.Now().UTC().Add(EXPIRE_AFTER_RESENDS * a.interval)
+}
+
+// Send the incident to every receiver
+func (a *Alertmanager) Send(i *event.Incident) error {
+	name := string(i.IndexName())
+	now := time.Now().UTC()
+	alerts := []Alert{}
+
+	a.Lock()
+	old, wasActive := a.active[name]
+
+	if i.Status == event.OK {
+
+		// end the active alert
+		if wasActive {
+			ended := *old
+			ended.EndsAt = now
+			alerts = append(alerts, ended)
+			delete(a.active, name)
+		}
+	} else {
+		al := a.newAlert(i)
+		al.EndsAt = a.expiry()
+
+		if wasActive {
+
+			// the alert is still firing since the first time it was seen
+			al.StartsAt = old.StartsAt
+
+			// a change in severity is a new alert to alertmanager, so end the old one
+			if old.Labels["severity"] != al.Labels["severity"] {
+				ended := *old
+				ended.EndsAt = now
+				alerts = append(alerts, ended)
+			}
+		}
+
+		a.active[name] = al
+		alerts = append(alerts, *al)
+	}
+	a.Unlock()
+
+	// resolving an incident that was never sent
+	if len(alerts) == 0 {
+		return nil
+	}
+
+	return a.post(alerts)
+}
+
+// resend posts every active alert on each interval, as alertmanager expects
+func (a *Alertmanager) resend(stop, done chan struct{}) {
+	t := time.NewTicker(a.interval)
+	defer t.Stop()
+	defer close(done)
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+		}
+
+		a.Lock()
+		alerts := make([]Alert, 0, len(a.active))
+		for _, al := range a.active {
+			al.EndsAt = a.expiry()
+			alerts = append(alerts, *al)
+		}
+		a.Unlock()
+
+		if len(alerts) == 0 {
+			continue
+		}
+
+		err := a.post(alerts)
+		if err != nil {
+			logrus.Errorf("Unable to resend active alerts: %s", err)
+		}
+
+		a.Lock()
+		a.lastErr = err
+		a.Unlock()
+	}
+}
+
+// Start resending the active alerts
+func (a *Alertmanager) Start() error {
+	a.Lock()
+	defer a.Unlock()
+
+	// already running
+	if a.stop != nil {
+		return nil
+	}
+
+	a.stop = make(chan struct{})
+	a.done = make(chan struct{})
+	go a.resend(a.stop, a.done)
+	return nil
+}
+
+// Close stops resending the active alerts, and waits for any resend in progress to finish. They will
+// expire on their own once their end time has passed
+func (a *Alertmanager) Close() error {
+	a.Lock()
+	stop, done := a.stop, a.done
+	a.stop, a.done = nil, nil
+	a.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+	return nil
+}
+
+// Health returns the error from the last time the active alerts were resent
+func (a *Alertmanager) Health() error {
+	a.Lock()
+	defer a.Unlock()
+	return a.lastErr
+}
+
+// post the alerts to every receiver
+func (a *Alertmanager) post(alerts []Alert) error {
+	buff, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+
+	errs := []string{}
+	for _, url := range a.conf.URLs {
+		err = a.postTo(strings.TrimRight(url, "/")+ALERTS_ENDPOINT, buff)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("Unable to post alerts: %s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// postTo posts the encoded alerts to a single receiver
+func (a *Alertmanager) postTo(url string, buff []byte) error {
+	resp, err := a.client.Post(url, "application/json", bytes.NewReader(buff))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(&io.LimitedReader{R: resp.Body, N: MAX_ERROR_BODY})
+		return fmt.Errorf("%s returned %s: %s", url, resp.Status, string(body))
+	}
+
+	return nil
+}
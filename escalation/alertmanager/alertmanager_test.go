@@ -0,0 +1,153 @@
+package alertmanager
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/eliothedeman/bangarang/event"
+)
+
+// a stand in for alertmanager that records every batch of alerts it is sent
+func newTestServer() (*httptest.Server, chan []*Alert) {
+	batches := make(chan []*Alert, 100)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != ALERTS_ENDPOINT {
+			http.NotFound(w, r)
+			return
+		}
+
+		alerts := []*Alert{}
+		json.NewDecoder(r.Body).Decode(&alerts)
+		batches <- alerts
+	}))
+
+	return s, batches
+}
+
+func newTestAlertmanager(t *testing.T, url, interval string) *Alertmanager {
+	a := NewAlertmanager().(*Alertmanager)
+	c := a.ConfigStruct().(*AlertmanagerConfig)
+	c.URLs = []string{url}
+	c.ResendInterval = interval
+	err := a.Init(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func newTestIncident(status int) *event.Incident {
+	e := event.NewEvent()
+	e.Tags.Set("host", "test.com")
+	e.Tags.Set("service", "cpu")
+	return event.NewIncident("cpu_high", status, e)
+}
+
+func TestFireAndResolve(t *testing.T) {
+	s, batches := newTestServer()
+	defer s.Close()
+	a := newTestAlertmanager(t, s.URL, "1h")
+
+	err := a.Send(newTestIncident(event.CRITICAL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fired := <-batches
+	if len(fired) != 1 {
+		t.Fatal(fired)
+	}
+
+	l := fired[0].Labels
+	if l["alertname"] != "cpu_high" || l["host"] != "test.com" || l["severity"] != "critical" {
+		t.Error(l)
+	}
+
+	if !fired[0].EndsAt.After(time.Now()) {
+		t.Error("An active alert should end in the future", fired[0].EndsAt)
+	}
+
+	err = a.Send(newTestIncident(event.OK))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolved := <-batches
+	if len(resolved) != 1 || resolved[0].EndsAt.After(time.Now()) {
+		t.Fatal(resolved)
+	}
+
+	if !resolved[0].StartsAt.Equal(fired[0].StartsAt) {
+		t.Error(resolved[0].StartsAt, fired[0].StartsAt)
+	}
+}
+
+func TestSeverityChange(t *testing.T) {
+	s, batches := newTestServer()
+	defer s.Close()
+	a := newTestAlertmanager(t, s.URL, "1h")
+
+	a.Send(newTestIncident(event.WARNING))
+	<-batches
+
+	a.Send(newTestIncident(event.CRITICAL))
+	changed := <-batches
+	if len(changed) != 2 {
+		t.Fatal(changed)
+	}
+
+	// the warning is ended, and the critical is started
+	if changed[0].Labels["severity"] != "warning" || changed[0].EndsAt.After(time.Now()) {
+		t.Error(changed[0])
+	}
+
+	if changed[1].Labels["severity"] != "critical" {
+		t.Error(changed[1])
+	}
+}
+
+func TestResend(t *testing.T) {
+	s, batches := newTestServer()
+	defer s.Close()
+	a := newTestAlertmanager(t, s.URL, "10ms")
+	a.Start()
+	defer a.Close()
+
+	a.Send(newTestIncident(event.CRITICAL))
+	<-batches
+
+	select {
+	case resent := <-batches:
+		if len(resent) != 1 || resent[0].Labels["alertname"] != "cpu_high" {
+			t.Error(resent)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Active alert was not resent")
+	}
+}
+
+func TestClose(t *testing.T) {
+	s, batches := newTestServer()
+	defer s.Close()
+	a := newTestAlertmanager(t, s.URL, "10ms")
+	a.Start()
+	a.Start()
+
+	a.Send(newTestIncident(event.CRITICAL))
+	<-batches
+	a.Close()
+
+	// drain anything sent before the close
+	for len(batches) > 0 {
+		<-batches
+	}
+
+	select {
+	case <-batches:
+		t.Error("Alerts should not be resent once the escalation is closed")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,92 @@
+package escalation
+
+import (
+	"bytes"
+	"text/template"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/eliothedeman/bangarang/event"
+)
+
+const (
+	ANNOTATION_RUNBOOK_URL   = "runbook_url"
+	ANNOTATION_DASHBOARD_URL = "dashboard_url"
+	ANNOTATION_OWNER         = "owner"
+	ANNOTATION_SEVERITY      = "severity"
+)
+
+// Annotations tell responders where to go for the incidents a policy creates. Every value is a
+// template rendered with the same data as the policy's description
+type Annotations struct {
+	DashboardURL string            `json:"dashboard_url"`
+	Owner        string            `json:"owner"`
+	Severity     string            `json:"severity"`
+	Extra        map[string]string `json:"extra"`
+}
+
+// rawAnnotations returns every annotation of the policy by name, including the runbook url
+func (p *Policy) rawAnnotations() map[string]string {
+	raw := map[string]string{}
+	if p.RunbookURL != "" {
+		raw[ANNOTATION_RUNBOOK_URL] = p.RunbookURL
+	}
+
+	a := p.Annotations
+	if a == nil {
+		return raw
+	}
+
+	for k, v := range a.Extra {
+		raw[k] = v
+	}
+
+	for k, v := range map[string]string{
+		ANNOTATION_DASHBOARD_URL: a.DashboardURL,
+		ANNOTATION_OWNER:         a.Owner,
+		ANNOTATION_SEVERITY:      a.Severity,
+	} {
+		if v != "" {
+			raw[k] = v
+		}
+	}
+
+	return raw
+}
+
+// compileAnnotations parses the template of every annotation of the policy
+func (p *Policy) compileAnnotations() (map[string]*template.Template, error) {
+	raw := p.rawAnnotations()
+	ts := make(map[string]*template.Template, len(raw))
+	for k, v := range raw {
+		t, err := NewTemplate("annotation_"+k, v)
+		if err != nil {
+			return nil, err
+		}
+
+		ts[k] = t
+	}
+
+	return ts, nil
+}
+
+// annotate renders the policy's annotations for the incident
+func (p *Policy) annotate(i *event.Incident) map[string]string {
+	if len(p.annotations) == 0 {
+		return nil
+	}
+
+	data := p.newDescriptionData(i)
+	a := make(map[string]string, len(p.annotations))
+	for k, t := range p.annotations {
+		buff := bytes.NewBuffer(nil)
+		err := t.Execute(buff, data)
+		if err != nil {
+			logrus.Errorf("Unable to render annotation %s for %s: %s", k, p.Name, err)
+			continue
+		}
+
+		a[k] = buff.String()
+	}
+
+	return a
+}
@@ -0,0 +1,140 @@
+package escalation
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/eliothedeman/bangarang/event"
+)
+
+// DescriptionData is what a policy's description and annotation templates are rendered with
+type DescriptionData struct {
+	Policy      string
+	Comment     string
+	RunbookURL  string
+	Status      int
+	Metric      float64
+	Time        int64
+	Tags        *event.TagSet
+	Annotations map[string]string
+
+	// the condition that created the incident, along with both of the policy's conditions
+	Condition *Condition
+	Crit      *Condition
+	Warn      *Condition
+}
+
+// descriptionTemplates holds the compiled description templates of a policy
+type descriptionTemplates struct {
+	all      *template.Template
+	byStatus map[int]*template.Template
+}
+
+// statusCodes maps a status name to its code
+var statusCodes = map[string]int{
+	event.Status(event.OK):       event.OK,
+	event.Status(event.WARNING):  event.WARNING,
+	event.Status(event.CRITICAL): event.CRITICAL,
+}
+
+// compileDescriptions parses the policy's description templates. A nil value is returned if the policy has none
+func (p *Policy) compileDescriptions() (*descriptionTemplates, error) {
+	if p.Description == "" && len(p.StatusDescriptions) == 0 {
+		return nil, nil
+	}
+
+	d := &descriptionTemplates{
+		byStatus: make(map[int]*template.Template, len(p.StatusDescriptions)),
+	}
+
+	var err error
+	if p.Description != "" {
+		d.all, err = NewTemplate("description", p.Description)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for name, text := range p.StatusDescriptions {
+		code, ok := statusCodes[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown status \"%s\" in status_descriptions", name)
+		}
+
+		d.byStatus[code], err = NewTemplate("description_"+name, text)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// newDescriptionData creates the data the policy's templates are rendered with for the incident
+func (p *Policy) newDescriptionData(i *event.Incident) *DescriptionData {
+	data := &DescriptionData{
+		Policy:      i.Policy,
+		Comment:     p.Comment,
+		RunbookURL:  p.RunbookURL,
+		Status:      i.Status,
+		Metric:      i.Metric,
+		Time:        i.Time,
+		Tags:        i.Tags,
+		Annotations: i.Annotations,
+		Crit:        p.Crit,
+		Warn:        p.Warn,
+	}
+
+	switch i.Status {
+	case event.CRITICAL:
+		data.Condition = p.Crit
+	case event.WARNING:
+		data.Condition = p.Warn
+	}
+
+	return data
+}
+
+// formatter returns an IncidentFormatter which renders the policy's templates. Incidents with
+// a status that has no template fall back to the default formatter
+func (p *Policy) formatter() event.IncidentFormatter {
+	d := p.descriptions
+	if d == nil {
+		return nil
+	}
+
+	return func(i *event.Incident) string {
+		t, ok := d.byStatus[i.Status]
+		if !ok {
+			t = d.all
+		}
+
+		if t == nil {
+			return event.DefaultIncidentFormatter(i)
+		}
+
+		buff := bytes.NewBuffer(nil)
+		err := t.Execute(buff, p.newDescriptionData(i))
+		if err != nil {
+			logrus.Errorf("Unable to render description for %s: %s", p.Name, err)
+			return event.DefaultIncidentFormatter(i)
+		}
+
+		return buff.String()
+	}
+}
+
+// newIncident creates an incident for the event which is annotated and described by the policy's templates
+func (p *Policy) newIncident(status int, e *event.Event) *event.Incident {
+	i := event.NewIncident(p.Name, status, e)
+	i.Annotations = p.annotate(i)
+	if f := p.formatter(); f != nil {
+		i.SetFormatter(f)
+		i.Description = i.FormatDescription()
+	}
+
+	i.SetResolve(p.resolve)
+	return i
+}
@@ -1,20 +1,52 @@
 package email
 
 import (
+	"bytes"
+	"crypto/tls"
 	"encoding/base64"
-	"encoding/json"
 	"fmt"
-	"log"
-	"net/mail"
+	html_template "html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
 	"net/smtp"
+	"net/textproto"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/eliothedeman/bangarang/escalation"
 	"github.com/eliothedeman/bangarang/event"
 )
 
+const (
+	TLS_NONE     = "none"
+	TLS_STARTTLS = "starttls"
+	TLS_IMPLICIT = "tls"
+
+	DEFAULT_SUBJECT        = "{{.FormatDescription}}"
+	DEFAULT_DIGEST_SUBJECT = "bangarang: {{len .}} incident(s)"
+	DEFAULT_BODY           = `{{.FormatDescription}}
+
+policy: {{.Policy}}
+status: {{status .Status}}
+metric: {{.Metric}}
+{{range .Tags}}{{.Key}}: {{.Value}}
+{{end}}{{range $k, $v := .Annotations}}{{$k}}: {{$v}}
+{{end}}`
+
+	// the length of each line of a base64 encoded body
+	BASE64_LINE_LENGTH = 76
+
+	// the most incidents held for a single recipient while their digest can't be sent. The oldest are dropped first
+	MAX_DIGEST_SIZE = 1000
+)
+
 func init() {
 	escalation.LoadFactory("email", NewEmail)
 }
@@ -22,76 +54,462 @@ func init() {
 type Email struct {
 	conf *EmailConfig
 	Auth *smtp.Auth
+
+	subject       *template.Template
+	body          *template.Template
+	htmlBody      *html_template.Template
+	digestSubject *template.Template
+
+	// incidents waiting to be sent in the next digest, by recipient
+	digestInterval time.Duration
+	digest         map[string][]*event.Incident
+	lastErr        error
+	stop           chan struct{}
+	done           chan struct{}
+	sync.Mutex
 }
 
 func NewEmail() escalation.Escalation {
 	e := &Email{
-		conf: &EmailConfig{},
-		Auth: nil,
+		conf: &EmailConfig{
+			Subject:       DEFAULT_SUBJECT,
+			Body:          DEFAULT_BODY,
+			DigestSubject: DEFAULT_DIGEST_SUBJECT,
+		},
+		Auth:   nil,
+		digest: make(map[string][]*event.Incident),
 	}
 	return e
 }
 
-func encodeRFC2047(String string) string {
-	//Make sure mail is rfc2047 compliant
-	addr := mail.Address{String, ""}
-	return strings.Trim(addr.String(), " <>")
+// writeHeaders writes the headers in a stable order
+func writeHeaders(buff *bytes.Buffer, headers map[string]string) {
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Fprintf(buff, "%s: %s\r\n", k, headers[k])
+	}
+}
+
+// writeBase64 writes the body as base64, wrapped to the maximum line length
+func writeBase64(buff *bytes.Buffer, body string) {
+	enc := base64.StdEncoding.EncodeToString([]byte(body))
+	for len(enc) > BASE64_LINE_LENGTH {
+		buff.WriteString(enc[:BASE64_LINE_LENGTH] + "\r\n")
+		enc = enc[BASE64_LINE_LENGTH:]
+	}
+	buff.WriteString(enc + "\r\n")
+}
+
+// writeEmailBuffer creates the message. An html body turns the message into multipart/alternative
+func writeEmailBuffer(headers map[string]string, body, html string) []byte {
+	buff := bytes.NewBuffer(nil)
+	headers["MIME-Version"] = "1.0"
+
+	if html == "" {
+		headers["Content-Type"] = "text/plain; charset=\"utf-8\""
+		headers["Content-Transfer-Encoding"] = "base64"
+		writeHeaders(buff, headers)
+		buff.WriteString("\r\n")
+		writeBase64(buff, body)
+		return buff.Bytes()
+	}
+
+	parts := bytes.NewBuffer(nil)
+	mp := multipart.NewWriter(parts)
+	for _, p := range []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=\"utf-8\"", body},
+		{"text/html; charset=\"utf-8\"", html},
+	} {
+		w, _ := mp.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		b := bytes.NewBuffer(nil)
+		writeBase64(b, p.body)
+		w.Write(b.Bytes())
+	}
+	mp.Close()
+
+	headers["Content-Type"] = "multipart/alternative; boundary=\"" + mp.Boundary() + "\""
+	writeHeaders(buff, headers)
+	buff.WriteString("\r\n")
+	buff.Write(parts.Bytes())
+	return buff.Bytes()
+}
+
+// executor is a text or html template
+type executor interface {
+	Execute(w io.Writer, data interface{}) error
 }
 
-func writeEmailBuffer(headers map[string]string, body string) string {
-	//Could pre-allocate an email buffer, but since an alert is a rather exceptional
-	//	event the gains are negligable
-	buf := ""
-	for k, v := range headers {
-		buf += fmt.Sprintf("%s: %s\r\n", k, v)
+// render executes the template
+func render(t executor, data interface{}) (string, error) {
+	buff := bytes.NewBuffer(nil)
+	err := t.Execute(buff, data)
+	return buff.String(), err
+}
+
+// compose renders the subject, body, and html body of a single incident
+func (e *Email) compose(i *event.Incident) (subject, body, html string, err error) {
+	subject, err = render(e.subject, i)
+	if err != nil {
+		return
+	}
+
+	body, err = render(e.body, i)
+	if err != nil {
+		return
+	}
+
+	if e.htmlBody != nil {
+		html, err = render(e.htmlBody, i)
 	}
-	buf += "\r\n" + base64.StdEncoding.EncodeToString([]byte(body))
-	return buf
+	return
 }
 
-// Send an email via smtp
+// Send an email via smtp. In digest mode, the incident is queued for the next digest
 func (e *Email) Send(i *event.Incident) error {
+	if e.conf.DigestInterval != "" {
+		e.Lock()
+		for _, r := range e.conf.Recipients {
+			e.queue(r, i)
+		}
+		e.Unlock()
+		return escalation.QUEUED
+	}
+
+	subject, body, html, err := e.compose(i)
+	if err != nil {
+		return err
+	}
+
+	return e.sendMail(e.conf.Recipients, subject, body, html)
+}
+
+// sendDigests sends every queued incident on each interval, one email per recipient
+func (e *Email) sendDigests(interval time.Duration, stop, done chan struct{}) {
+	defer close(done)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+		}
+
+		err := e.flush()
+		if err != nil {
+			logrus.Errorf("Unable to send email digest: %s", err)
+		}
+
+		e.Lock()
+		e.lastErr = err
+		e.Unlock()
+	}
+}
+
+// Start sending digests, if digests are enabled
+func (e *Email) Start() error {
+	e.Lock()
+	defer e.Unlock()
+	if e.digestInterval <= 0 || e.stop != nil {
+		return nil
+	}
+
+	e.stop = make(chan struct{})
+	e.done = make(chan struct{})
+	go e.sendDigests(e.digestInterval, e.stop, e.done)
+	return nil
+}
+
+// Close stops sending digests, and sends whatever is left in the current one
+func (e *Email) Close() error {
+	e.Lock()
+	stop, done := e.stop, e.done
+	e.stop, e.done = nil, nil
+	e.Unlock()
+
+	if stop == nil {
+		return nil
+	}
+
+	// wait for a digest that is being sent, so the final one goes out after it
+	close(stop)
+	<-done
+	return e.flush()
+}
+
+// Health returns the error from the last digest that was sent
+func (e *Email) Health() error {
+	e.Lock()
+	defer e.Unlock()
+	return e.lastErr
+}
+
+// queue adds the incidents to the recipient's next digest. The lock must be held
+func (e *Email) queue(r string, ins ...*event.Incident) {
+	q := append(e.digest[r], ins...)
+	if len(q) > MAX_DIGEST_SIZE {
+		logrus.Warnf("Dropping %d incident(s) from the email digest for %s", len(q)-MAX_DIGEST_SIZE, r)
+		q = q[len(q)-MAX_DIGEST_SIZE:]
+	}
+	e.digest[r] = q
+}
+
+// flush sends the queued incidents to each recipient. Digests that can't be sent are queued again
+// for the next attempt, in front of anything queued since
+func (e *Email) flush() error {
+	e.Lock()
+	digest := e.digest
+	e.digest = make(map[string][]*event.Incident)
+	e.Unlock()
+
+	var last error
+	for r, ins := range digest {
+		err := e.sendDigest(r, ins)
+		if err != nil {
+			last = err
+
+			e.Lock()
+			queued := e.digest[r]
+			e.digest[r] = nil
+			e.queue(r, append(ins, queued...)...)
+			e.Unlock()
+		}
+	}
 
-	//For now set the description as both the subject and body
+	return last
+}
+
+// sendDigest sends a single digest to the recipient. An incident that can't be rendered is left
+// out, so it can't hold back the rest
+func (e *Email) sendDigest(r string, ins []*event.Incident) error {
+	subject, err := render(e.digestSubject, ins)
+	if err != nil {
+		logrus.Errorf("Unable to render the email digest subject: %s", err)
+		subject = fmt.Sprintf("bangarang: %d incident(s)", len(ins))
+	}
+
+	bodies := make([]string, 0, len(ins))
+	htmls := make([]string, 0, len(ins))
+	for _, i := range ins {
+		_, body, html, err := e.compose(i)
+		if err != nil {
+			logrus.Errorf("Unable to render incident %s for the email digest: %s", i.IndexName(), err)
+			continue
+		}
+		bodies = append(bodies, body)
+		htmls = append(htmls, html)
+	}
+
+	if len(bodies) == 0 {
+		return nil
+	}
+
+	html := ""
+	if e.htmlBody != nil {
+		html = strings.Join(htmls, "\n<hr>\n")
+	}
+
+	return e.sendMail([]string{r}, subject, strings.Join(bodies, "\n----\n\n"), html)
+}
+
+// tlsConfig returns the tls options for the smtp server
+func (e *Email) tlsConfig() *tls.Config {
+	return &tls.Config{
+		ServerName:         e.conf.Host,
+		InsecureSkipVerify: e.conf.InsecureSkipVerify,
+	}
+}
+
+// dial connects to the smtp server, and negotiates tls and auth
+func (e *Email) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(e.conf.Host, strconv.Itoa(e.conf.Port))
+
+	var c *smtp.Client
+	if e.conf.TLS == TLS_IMPLICIT {
+		conn, err := tls.Dial("tcp", addr, e.tlsConfig())
+		if err != nil {
+			return nil, err
+		}
+
+		c, err = smtp.NewClient(conn, e.conf.Host)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	} else {
+		var err error
+		c, err = smtp.Dial(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		// upgrade to tls when the server supports it, or fail if it is required
+		if e.conf.TLS != TLS_NONE {
+			if ok, _ := c.Extension("STARTTLS"); ok {
+				err = c.StartTLS(e.tlsConfig())
+				if err != nil {
+					c.Close()
+					return nil, err
+				}
+			} else if e.conf.TLS == TLS_STARTTLS {
+				c.Close()
+				return nil, fmt.Errorf("%s does not support STARTTLS", addr)
+			}
+		}
+	}
+
+	if e.Auth != nil {
+		if ok, _ := c.Extension("AUTH"); ok {
+			err := c.Auth(*e.Auth)
+			if err != nil {
+				c.Close()
+				return nil, err
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// sendMail sends a single message to the recipients
+func (e *Email) sendMail(to []string, subject, body, html string) error {
 	headers := make(map[string]string)
 	headers["From"] = e.conf.Sender
-	headers["To"] = strings.Join(e.conf.Recipients, ",")
-	headers["Subject"] = i.FormatDescription()
-	headers["MIME-Version"] = "1.0"
-	headers["Content-Type"] = "text/plain; charset=\"utf-8\""
-	headers["Content-Transfer-Encoding"] = "base64"
+	headers["To"] = strings.Join(to, ",")
+	headers["Subject"] = mime.QEncoding.Encode("utf-8", subject)
+	headers["Date"] = time.Now().Format(time.RFC1123Z)
+
+	c, err := e.dial()
+	if err != nil {
+		logrus.Errorf("Unable to connect to smtp server %s", err)
+		return err
+	}
+	defer c.Close()
 
-	// make the body a json encoded representation of the incidnent
-	body, err := json.MarshalIndent(i, "", "    ")
+	err = c.Mail(e.conf.Sender)
 	if err != nil {
-		logrus.Errorf("Unable to encode incidnet for email %s", err.Error())
+		return err
+	}
+
+	for _, r := range to {
+		err = c.Rcpt(r)
+		if err != nil {
+			return err
+		}
 	}
 
-	log.Println("sending email")
-	err = smtp.SendMail(e.conf.Host+":"+strconv.Itoa(e.conf.Port), *e.Auth,
-		e.conf.Sender, e.conf.Recipients, []byte(writeEmailBuffer(headers, string(body))))
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(writeEmailBuffer(headers, body, html))
+	if err != nil {
+		return err
+	}
+
+	err = w.Close()
 	if err != nil {
 		logrus.Errorf("Unable to send email via smtp %s", err)
+		return err
 	}
-	log.Println("done sending mail")
-	return err
+
+	return c.Quit()
 }
 
 func (e *Email) ConfigStruct() interface{} {
 	return e.conf
 }
 
-func (e *Email) Init(conf interface{}) error {
-	auth := smtp.PlainAuth("", e.conf.User, e.conf.Password, e.conf.Host)
-	e.Auth = &auth
+func (e *Email) Init(i interface{}) error {
+	conf, ok := i.(*EmailConfig)
+	if !ok {
+		return fmt.Errorf("Incorrect config type. Expecting EmailConfig not %+v", i)
+	}
+
+	switch conf.TLS {
+	case "", TLS_NONE, TLS_STARTTLS, TLS_IMPLICIT:
+	default:
+		return fmt.Errorf("Unknown tls mode %s", conf.TLS)
+	}
+
+	var err error
+	e.subject, err = escalation.NewTemplate("subject", conf.Subject)
+	if err != nil {
+		return err
+	}
+
+	e.body, err = escalation.NewTemplate("body", conf.Body)
+	if err != nil {
+		return err
+	}
+
+	if conf.HTMLBody != "" {
+		e.htmlBody, err = escalation.NewHTMLTemplate("html_body", conf.HTMLBody)
+		if err != nil {
+			return err
+		}
+	}
+
+	e.digestSubject, err = escalation.NewTemplate("digest_subject", conf.DigestSubject)
+	if err != nil {
+		return err
+	}
+
+	// only authenticate when credentials are given
+	if conf.User != "" {
+		auth := smtp.PlainAuth("", conf.User, conf.Password, conf.Host)
+		e.Auth = &auth
+	}
+
+	e.conf = conf
+
+	if conf.DigestInterval != "" {
+		interval, err := time.ParseDuration(conf.DigestInterval)
+		if err != nil {
+			return err
+		}
+
+		if interval <= 0 {
+			return fmt.Errorf("The digest_interval must be greater than 0")
+		}
+
+		e.digestInterval = interval
+	}
+
 	return nil
 }
 
 type EmailConfig struct {
-	Sender     string   `json:"source_email"`
-	Recipients []string `json:"dest_emails"`
-	Host       string   `json:"host"`
+	Sender     string   `json:"source_email" schema:"required"`
+	Recipients []string `json:"dest_emails" schema:"required"`
+	Host       string   `json:"host" schema:"required"`
 	User       string   `json:"user"`
-	Password   string   `json:"password"`
+	Password   string   `json:"password" schema:"secret"`
 	Port       int      `json:"port"`
+
+	// one of "none", "starttls", or "tls". By default STARTTLS is used when the server supports it
+	TLS                string `json:"tls"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+
+	// templates rendered from the incident. The html body is optional
+	Subject  string `json:"subject"`
+	Body     string `json:"body"`
+	HTMLBody string `json:"html_body"`
+
+	// when set, incidents are batched into one email per recipient on this interval
+	DigestInterval string `json:"digest_interval"`
+	DigestSubject  string `json:"digest_subject"`
 }
@@ -1,8 +1,21 @@
 package email
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
 	"testing"
+
+	"github.com/eliothedeman/bangarang/escalation"
+	"github.com/eliothedeman/bangarang/event"
 )
 
 const (
@@ -33,3 +46,322 @@ func TestParse(t *testing.T) {
 		t.Error("Email config not properly parsed")
 	}
 }
+
+// a stand in smtp server that records every message it receives
+type testSMTP struct {
+	listener net.Listener
+	messages chan *mail.Message
+	starttls bool
+}
+
+func newTestSMTP(t *testing.T, starttls bool) *testSMTP {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &testSMTP{
+		listener: l,
+		messages: make(chan *mail.Message, 10),
+		starttls: starttls,
+	}
+	go s.serve()
+	return s
+}
+
+func (s *testSMTP) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *testSMTP) serve() {
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(c)
+	}
+}
+
+func (s *testSMTP) handle(c net.Conn) {
+	defer c.Close()
+	tc := textproto.NewConn(c)
+	tc.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := tc.ReadLine()
+		if err != nil {
+			return
+		}
+
+		switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); cmd {
+		case "EHLO", "HELO":
+			if s.starttls {
+				tc.PrintfLine("250-localhost")
+				tc.PrintfLine("250 STARTTLS")
+			} else {
+				tc.PrintfLine("250 localhost")
+			}
+		case "DATA":
+			tc.PrintfLine("354 go ahead")
+			buff, err := tc.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			m, err := mail.ReadMessage(bytes.NewReader(buff))
+			if err == nil {
+				s.messages <- m
+			}
+			tc.PrintfLine("250 ok")
+		case "QUIT":
+			tc.PrintfLine("221 bye")
+			return
+		case "STARTTLS":
+			tc.PrintfLine("454 not today")
+		default:
+			tc.PrintfLine("250 ok")
+		}
+	}
+}
+
+func newTestEmail(t *testing.T, port int, modify func(c *EmailConfig)) *Email {
+	e := NewEmail().(*Email)
+	c := e.ConfigStruct().(*EmailConfig)
+	c.Sender = "bangarang@test.com"
+	c.Recipients = []string{"a@test.com", "b@test.com"}
+	c.Host = "127.0.0.1"
+	c.Port = port
+	c.TLS = TLS_NONE
+	if modify != nil {
+		modify(c)
+	}
+
+	err := e.Init(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func newTestIncident(host string) *event.Incident {
+	e := event.NewEvent()
+	e.Tags.Set("host", host)
+	e.Tags.Set("service", "cpu")
+	return event.NewIncident("cpu_high", event.CRITICAL, e)
+}
+
+func readBody(t *testing.T, r io.Reader) string {
+	buff, err := ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buff)
+}
+
+func TestSendTemplates(t *testing.T) {
+	s := newTestSMTP(t, false)
+	defer s.listener.Close()
+
+	e := newTestEmail(t, s.port(), func(c *EmailConfig) {
+		c.Subject = "[{{status .Status}}] {{.Tags.Get \"host\"}}"
+		c.Body = "{{.Policy}} fired"
+	})
+
+	err := e.Send(newTestIncident("test.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := <-s.messages
+	if m.Header.Get("Subject") != "[critical] test.com" {
+		t.Error(m.Header.Get("Subject"))
+	}
+
+	if body := readBody(t, m.Body); body != "cpu_high fired" {
+		t.Error(body)
+	}
+}
+
+func TestSendHTML(t *testing.T) {
+	s := newTestSMTP(t, false)
+	defer s.listener.Close()
+
+	e := newTestEmail(t, s.port(), func(c *EmailConfig) {
+		c.HTMLBody = "<b>{{.Policy}}</b>"
+	})
+
+	err := e.Send(newTestIncident("test.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := <-s.messages
+	mt, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || mt != "multipart/alternative" {
+		t.Fatal(mt, err)
+	}
+
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	plain, err := mr.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := readBody(t, plain); !strings.Contains(body, "host: test.com") {
+		t.Error(body)
+	}
+
+	html, err := mr.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := readBody(t, html); body != "<b>cpu_high</b>" {
+		t.Error(body)
+	}
+}
+
+func TestSendHTMLEscape(t *testing.T) {
+	s := newTestSMTP(t, false)
+	defer s.listener.Close()
+
+	e := newTestEmail(t, s.port(), func(c *EmailConfig) {
+		c.HTMLBody = "<b>{{.Tags.Get \"host\"}}</b>"
+	})
+
+	err := e.Send(newTestIncident("<script>x</script>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := <-s.messages
+	_, params, _ := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	mr.NextPart()
+	html, err := mr.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body := readBody(t, html); body != "<b>&lt;script&gt;x&lt;/script&gt;</b>" {
+		t.Error(body)
+	}
+}
+
+func TestStartTLSRequired(t *testing.T) {
+	s := newTestSMTP(t, false)
+	defer s.listener.Close()
+
+	e := newTestEmail(t, s.port(), func(c *EmailConfig) {
+		c.TLS = TLS_STARTTLS
+	})
+
+	if e.Send(newTestIncident("test.com")) == nil {
+		t.Fatal("Expected an error when STARTTLS is required but not supported")
+	}
+}
+
+func TestDigest(t *testing.T) {
+	s := newTestSMTP(t, false)
+	defer s.listener.Close()
+
+	e := newTestEmail(t, s.port(), func(c *EmailConfig) {
+		c.DigestInterval = "1h"
+		c.Body = "{{.Tags.Get \"host\"}}"
+	})
+
+	if e.Send(newTestIncident("one.com")) != escalation.QUEUED {
+		t.Fatal("Expected the incident to be queued")
+	}
+	e.Send(newTestIncident("two.com"))
+
+	err := e.flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// one message per recipient
+	for x := 0; x < 2; x++ {
+		m := <-s.messages
+		if m.Header.Get("Subject") != "bangarang: 2 incident(s)" {
+			t.Error(m.Header.Get("Subject"))
+		}
+
+		body := readBody(t, m.Body)
+		if !strings.Contains(body, "one.com") || !strings.Contains(body, "two.com") {
+			t.Error(body)
+		}
+	}
+
+	// nothing is left to send
+	e.flush()
+	select {
+	case m := <-s.messages:
+		t.Error("Unexpected message", m.Header)
+	default:
+	}
+}
+
+func TestStartClose(t *testing.T) {
+	s := newTestSMTP(t, false)
+	defer s.listener.Close()
+
+	e := newTestEmail(t, s.port(), func(c *EmailConfig) {
+		c.DigestInterval = "1h"
+	})
+
+	// starting again doesn't start another sender
+	e.Start()
+	done := e.done
+	e.Start()
+	if e.done != done {
+		t.Fatal("Start should do nothing when digests are already being sent")
+	}
+
+	e.Send(newTestIncident("one.com"))
+	err := e.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the sender has exited, and the last digest went out
+	<-done
+	for x := 0; x < 2; x++ {
+		<-s.messages
+	}
+
+	if e.Close() != nil {
+		t.Error("Closing twice should do nothing")
+	}
+}
+
+func TestDigestRetry(t *testing.T) {
+	s := newTestSMTP(t, false)
+	port := s.port()
+	s.listener.Close()
+
+	e := newTestEmail(t, port, func(c *EmailConfig) {
+		c.DigestInterval = "1h"
+		c.Body = "{{.Tags.Get \"host\"}}"
+	})
+
+	e.Send(newTestIncident("one.com"))
+	if e.flush() == nil {
+		t.Fatal("Expected an error when the smtp server is down")
+	}
+
+	// the failed digest is sent with the next one
+	e.Send(newTestIncident("two.com"))
+	s = newTestSMTP(t, false)
+	defer s.listener.Close()
+	e.conf.Port = s.port()
+
+	err := e.flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for x := 0; x < 2; x++ {
+		m := <-s.messages
+		if m.Header.Get("Subject") != "bangarang: 2 incident(s)" {
+			t.Error(m.Header.Get("Subject"))
+		}
+	}
+}
@@ -2,7 +2,11 @@ package escalation
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/eliothedeman/bangarang/event"
@@ -13,6 +17,9 @@ var (
 		// maps an Escalation type name to an Escalation
 		factories: make(map[string]Factory),
 	}
+
+	// QUEUED is returned by Send when the incident was accepted, but will be sent later
+	QUEUED = errors.New("Queued to be sent later")
 )
 
 // EscalationPolicy is the collection of Escalations that are subscribed to by the policy
@@ -26,16 +33,54 @@ type EscalationPolicy struct {
 	Comment  string            `json:"comment"`
 	Configs  []json.RawMessage `json:"configs"`
 
+	// the policy only sends incidents during these windows. Always active if empty
+	ActiveTimes []*TimeWindow `json:"active_times"`
+
+	// hold incidents that arrive outside of the active windows until the next window opens, instead of dropping them
+	QueueOutsideWindows bool `json:"queue_outside_windows"`
+
 	// compiled regex matches
 	rMatch    Matcher
 	rNotMatch Matcher
 
 	// Escalations to forward incidents to
 	Escalations []Escalation `json:"-"`
+
+	// the name and type of each escalation, in the same order as Escalations
+	meta []escalationMeta
+
+	// incidents waiting for the next active window
+	queue     []*event.Incident
+	queueLock sync.Mutex
+}
+
+// escalationMeta describes an escalation as it was configured
+type escalationMeta struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+// describe returns the configured name and type of the escalation at the given index
+func (e *EscalationPolicy) describe(index int) escalationMeta {
+	if index < len(e.meta) {
+		return e.meta[index]
+	}
+
+	// escalations that were added without a config are known only by their go type
+	return escalationMeta{
+		Type: fmt.Sprintf("%T", e.Escalations[index]),
+	}
 }
 
 // Compile sets up all the regex matches for the subscriptions and starts all of the Escalations held by the policy
-func (e *EscalationPolicy) Compile() (err error) {
+func (e *EscalationPolicy) Compile() error {
+	return e.CompileFrom(nil)
+}
+
+// CompileFrom compiles the policy like Compile, but keeps any escalation of the old policy whose
+// config hasn't changed instead of starting a new one. The old policy gives up the escalations that
+// are kept, so closing it only closes the escalations that are no longer used
+func (e *EscalationPolicy) CompileFrom(old *EscalationPolicy) (err error) {
 	// create a matcher from each tagset
 
 	if e.Match != nil {
@@ -53,25 +98,72 @@ func (e *EscalationPolicy) Compile() (err error) {
 
 	}
 
+	err = e.compileWindows()
+	if err != nil {
+		return
+	}
+
 	// if the configs aren't set, don't write over them
 	if e.Configs == nil {
+		old.handOver(e)
 		return nil
 	}
 
 	// create enough space for all of the new Escalations
 	e.Escalations = make([]Escalation, 0, len(e.Configs))
+	e.meta = make([]escalationMeta, 0, len(e.Configs))
+
+	// the escalations taken from the old policy, by their index in it
+	taken := make(map[int]Escalation)
+
+	// if anything fails, the old policy gets its escalations back and the new ones are closed
+	defer func() {
+		if err == nil {
+			old.handOver(e)
+			return
+		}
+
+		for x, esc := range taken {
+			old.Escalations[x] = esc
+		}
+
+		kept := make([]Escalation, 0, len(e.Escalations)-len(taken))
+		for _, esc := range e.Escalations {
+			if !takenFrom(taken, esc) {
+				kept = append(kept, esc)
+			}
+		}
+		e.Escalations = kept
+		e.Close()
+		e.Escalations = nil
+		e.meta = nil
+	}()
 
 	// go through each config and creat an escalation out of it
 	for _, raw := range e.Configs {
 
+		// nothing to do if the escalation is already running
+		if esc, meta, x, ok := old.take(raw); ok {
+			taken[x] = esc
+			e.Escalations = append(e.Escalations, esc)
+			e.meta = append(e.meta, meta)
+			continue
+		}
+
 		// run parsing logic on the config
-		newEscalation, perr := parseEscalation(raw)
+		newEscalation, meta, perr := parseEscalation(raw)
+		if perr != nil {
+			return perr
+		}
+
+		perr = start(newEscalation)
 		if perr != nil {
 			return perr
 		}
 
 		// if all is well, append the new escalation
 		e.Escalations = append(e.Escalations, newEscalation)
+		e.meta = append(e.meta, meta)
 
 	}
 
@@ -105,37 +197,89 @@ func (e *EscalationPolicy) isSubscribed(i *event.Incident) bool {
 
 // PassIncident takes an incident into the escalation for processing
 func (e *EscalationPolicy) PassIncident(i *event.Incident) {
+	e.Deliver(i)
+}
+
+// Deliver sends the incident to every escalation if the policy is subscribed to it, and returns a record of each attempt
+func (e *EscalationPolicy) Deliver(i *event.Incident) []*event.Delivery {
+
+	// a newer update replaces a held one, even if the policy doesn't subscribe to it. Otherwise an
+	// incident that resolved would still be sent once the window opens
+	if e.release(i) {
+		return nil
+	}
 
 	// only process incidents that this policy subscribes to
-	if e.isSubscribed(i) {
+	if !e.isSubscribed(i) {
+		return nil
+	}
 
-		// send if off to every escalation known about
-		for _, ep := range e.Escalations {
-			err := ep.Send(i)
-			if err != nil {
-				logrus.Errorf("Unable to forward incident %s to escalation %+v", i.FormatDescription(), ep)
-			}
+	if !e.Active(time.Now()) {
+		if e.QueueOutsideWindows {
+			e.enqueue(i)
 		}
+		return nil
 	}
+
+	return e.send(i)
+}
+
+// Test sends the incident to every escalation, regardless of what the policy is subscribed to or when it is active
+func (e *EscalationPolicy) Test(i *event.Incident) []*event.Delivery {
+	return e.send(i)
+}
+
+// send the incident to every escalation
+func (e *EscalationPolicy) send(i *event.Incident) []*event.Delivery {
+	deliveries := make([]*event.Delivery, 0, len(e.Escalations))
+
+	// send if off to every escalation known about
+	for x, ep := range e.Escalations {
+
+		// taken by the policy that replaced this one
+		if ep == nil {
+			continue
+		}
+
+		meta := e.describe(x)
+		d := event.NewDelivery(i, meta.Name, meta.Type)
+		start := time.Now()
+		err := ep.Send(i)
+		if err == QUEUED {
+			d.Queue(start)
+			err = nil
+		} else {
+			d.Done(start, err)
+		}
+
+		if err != nil {
+			logrus.Errorf("Unable to forward incident %s to escalation %+v: %s", i.FormatDescription(), ep, err)
+		}
+
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries
 }
 
 // parseEscalation given a raw config, create a new escalation
-func parseEscalation(buff json.RawMessage) (Escalation, error) {
-	name := &struct {
-		Type string `json:"type"`
-		Name string `json:"name"`
-	}{}
+func parseEscalation(buff json.RawMessage) (Escalation, escalationMeta, error) {
+	name := escalationMeta{}
 
 	var err error
 
 	// parse out the name/escalation type
-	err = json.Unmarshal(buff, name)
+	err = json.Unmarshal(buff, &name)
 	if err != nil {
-		return nil, err
+		return nil, name, err
 	}
 
 	// create a new escalation of the correct type
-	newEscalation := GetFactory(name.Type)()
+	f := GetFactory(name.Type)
+	if f == nil {
+		return nil, name, UnknownEscalationType(name.Type)
+	}
+	newEscalation := f()
 
 	// get the config struct to unmarshal into
 	conf := newEscalation.ConfigStruct()
@@ -143,12 +287,12 @@ func parseEscalation(buff json.RawMessage) (Escalation, error) {
 	// unmarshal into config struct
 	err = json.Unmarshal(buff, conf)
 	if err != nil {
-		return nil, err
+		return nil, name, err
 	}
 
 	// init the new escalation with the config
 	err = newEscalation.Init(conf)
-	return newEscalation, err
+	return newEscalation, name, err
 }
 
 // GetFactory returns the Factory associated with the given name
@@ -159,6 +303,19 @@ func GetFactory(name string) Factory {
 	return a
 }
 
+// Types returns the name of every loaded Factory, sorted
+func Types() []string {
+	Escalations.Lock()
+	names := make([]string, 0, len(Escalations.factories))
+	for name := range Escalations.factories {
+		names = append(names, name)
+	}
+	Escalations.Unlock()
+
+	sort.Strings(names)
+	return names
+}
+
 // LoadFactory loads an Factory into the globaly available map of EscalationFactories
 func LoadFactory(name string, f Factory) {
 	logrus.Debugf("Loading Escalation factory %s", name)
@@ -175,6 +332,13 @@ type Escalation interface {
 	Init(interface{}) error
 }
 
+// UnknownEscalationType is returned when no Factory is loaded for the type of an escalation
+type UnknownEscalationType string
+
+func (u UnknownEscalationType) Error() string {
+	return fmt.Sprintf("Unknown escalation type: %s", string(u))
+}
+
 // Factory returns a new Escalation
 type Factory func() Escalation
 
@@ -0,0 +1,37 @@
+package escalation
+
+import (
+	"testing"
+
+	"github.com/eliothedeman/bangarang/event"
+)
+
+func TestEscalationPolicyTest(t *testing.T) {
+	c := &countingEscalation{}
+	match := event.NewTagset(0)
+	match.Set("host", "nothing")
+
+	// subscribed to nothing
+	e := &EscalationPolicy{
+		Match:       match,
+		Escalations: []Escalation{c},
+	}
+
+	err := e.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ev := event.NewEvent()
+	ev.Tags.Set("host", "test")
+	i := event.NewIncident("test", event.CRITICAL, ev)
+
+	if len(e.Deliver(i)) != 0 {
+		t.Fatal("The policy should not be subscribed")
+	}
+
+	ds := e.Test(i)
+	if len(ds) != 1 || !ds[0].Success || len(c.sent) != 1 {
+		t.Error(ds, c.sent)
+	}
+}
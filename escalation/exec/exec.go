@@ -0,0 +1,178 @@
+package exec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	std_exec "os/exec"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/eliothedeman/bangarang/escalation"
+	"github.com/eliothedeman/bangarang/event"
+)
+
+const (
+	DEFAULT_TIMEOUT        = "30s"
+	DEFAULT_MAX_CONCURRENT = 4
+	ENV_PREFIX             = "BANGARANG_"
+	TAG_ENV_PREFIX         = ENV_PREFIX + "TAG_"
+
+	// the most of a command's stderr that will be included in an error
+	MAX_ERROR_OUTPUT = 512
+)
+
+func init() {
+	escalation.LoadFactory("exec", NewExec)
+}
+
+// Exec runs a command for every incident, with the incident encoded as json on stdin. Send blocks
+// until the command exits, so a slow command holds up the incident that is being escalated
+type Exec struct {
+	conf    *ExecConfig
+	timeout time.Duration
+
+	// limits the number of commands running at once
+	running chan struct{}
+}
+
+// ExecConfig holds the options for the exec escalation
+type ExecConfig struct {
+	Command       string            `json:"command" schema:"required"`
+	Args          []string          `json:"args"`
+	Dir           string            `json:"dir"`
+	Env           map[string]string `json:"env" schema:"secret"`
+	Timeout       string            `json:"timeout"`
+	MaxConcurrent int               `json:"max_concurrent"`
+}
+
+func NewExec() escalation.Escalation {
+	return &Exec{}
+}
+
+func (e *Exec) ConfigStruct() interface{} {
+	return &ExecConfig{
+		Timeout:       DEFAULT_TIMEOUT,
+		MaxConcurrent: DEFAULT_MAX_CONCURRENT,
+	}
+}
+
+func (e *Exec) Init(i interface{}) error {
+	logrus.Info("Initializing exec escalation")
+	c, ok := i.(*ExecConfig)
+	if !ok {
+		return fmt.Errorf("Incorrect config type. Expecting ExecConfig not %+v", i)
+	}
+
+	if c.Command == "" {
+		return fmt.Errorf("A command must be provided for the exec escalation")
+	}
+
+	// make sure the command can be found before an incident needs it
+	_, err := std_exec.LookPath(c.Command)
+	if err != nil {
+		return err
+	}
+
+	e.timeout, err = time.ParseDuration(c.Timeout)
+	if err != nil {
+		return err
+	}
+
+	if c.MaxConcurrent < 1 {
+		return fmt.Errorf("max_concurrent must be at least 1")
+	}
+
+	e.conf = c
+	e.running = make(chan struct{}, c.MaxConcurrent)
+	return nil
+}
+
+// envName turns a tag key into an environment variable name
+func envName(key string) string {
+	return TAG_ENV_PREFIX + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+// environ builds the environment the command is run with
+func (e *Exec) environ(i *event.Incident) []string {
+	env := os.Environ()
+	for k, v := range e.conf.Env {
+		env = append(env, k+"="+v)
+	}
+
+	env = append(env,
+		ENV_PREFIX+"INCIDENT="+string(i.IndexName()),
+		ENV_PREFIX+"POLICY="+i.Policy,
+		ENV_PREFIX+"STATUS="+event.Status(i.Status),
+		ENV_PREFIX+"METRIC="+fmt.Sprint(i.Metric),
+		ENV_PREFIX+"DESCRIPTION="+i.Description,
+	)
+
+	i.Tags.ForEach(func(k, v string) {
+		env = append(env, envName(k)+"="+v)
+	})
+
+	return env
+}
+
+// Send runs the command for the incident, once fewer than max_concurrent commands are running.
+// A non-zero exit is a failed delivery
+func (e *Exec) Send(i *event.Incident) error {
+	stdin, err := json.Marshal(i)
+	if err != nil {
+		return err
+	}
+
+	// wait for a free slot
+	e.running <- struct{}{}
+	defer func() {
+		<-e.running
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	stdout := bytes.NewBuffer(nil)
+	stderr := bytes.NewBuffer(nil)
+	cmd := std_exec.CommandContext(ctx, e.conf.Command, e.conf.Args...)
+	cmd.Dir = e.conf.Dir
+	cmd.Env = e.environ(i)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err = cmd.Run()
+
+	if stdout.Len() > 0 {
+		logrus.Infof("%s stdout: %s", e.conf.Command, stdout.String())
+	}
+
+	if stderr.Len() > 0 {
+		logrus.Warnf("%s stderr: %s", e.conf.Command, stderr.String())
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%s timed out after %s", e.conf.Command, e.timeout)
+	}
+
+	if err != nil {
+		out := stderr.String()
+		if len(out) > MAX_ERROR_OUTPUT {
+			out = out[:MAX_ERROR_OUTPUT]
+		}
+		return fmt.Errorf("%s failed: %s %s", e.conf.Command, err, out)
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package exec
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eliothedeman/bangarang/event"
+)
+
+func newTestExec(t *testing.T, timeout string, args ...string) *Exec {
+	e := NewExec().(*Exec)
+	c := e.ConfigStruct().(*ExecConfig)
+	c.Command = "sh"
+	c.Args = append([]string{"-c"}, args...)
+	c.Timeout = timeout
+	err := e.Init(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func newTestIncident() *event.Incident {
+	e := event.NewEvent()
+	e.Tags.Set("host", "test.com")
+	e.Tags.Set("sub-service", "load")
+	return event.NewIncident("load_high", event.CRITICAL, e)
+}
+
+func TestStdinAndEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bangarang-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "out")
+	e := newTestExec(t, "5s", `cat > `+out+`; echo >> `+out+`; echo "$BANGARANG_POLICY $BANGARANG_STATUS $BANGARANG_TAG_HOST $BANGARANG_TAG_SUB_SERVICE" >> `+out)
+
+	err = e.Send(newTestIncident())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buff, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(buff)), "\n")
+	if !strings.Contains(lines[0], `"policy":"load_high"`) {
+		t.Error(lines[0])
+	}
+
+	if lines[len(lines)-1] != "load_high critical test.com load" {
+		t.Error(lines[len(lines)-1])
+	}
+}
+
+func TestNonZeroExit(t *testing.T) {
+	e := newTestExec(t, "5s", "echo broken >&2; exit 3")
+
+	err := e.Send(newTestIncident())
+	if err == nil {
+		t.Fatal("Expected an error for a non-zero exit")
+	}
+
+	if !strings.Contains(err.Error(), "exit status 3") || !strings.Contains(err.Error(), "broken") {
+		t.Error(err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	e := newTestExec(t, "10ms", "exec sleep 5")
+
+	err := e.Send(newTestIncident())
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatal(err)
+	}
+}
+
+func TestInitUnknownCommand(t *testing.T) {
+	e := NewExec()
+	c := e.ConfigStruct().(*ExecConfig)
+	c.Command = "bangarang-no-such-command"
+	if e.Init(c) == nil {
+		t.Fatal("Expected an error for a missing command")
+	}
+}
+
+func TestMaxConcurrent(t *testing.T) {
+	e := newTestExec(t, "5s", "sleep 0.2")
+
+	// only one of the two commands runs at a time
+	e.running = make(chan struct{}, 1)
+	start := time.Now()
+	done := make(chan error, 2)
+	for x := 0; x < 2; x++ {
+		go func() {
+			done <- e.Send(newTestIncident())
+		}()
+	}
+
+	for x := 0; x < 2; x++ {
+		err := <-done
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if time.Since(start) < 400*time.Millisecond {
+		t.Error("Expected the commands to run one after the other")
+	}
+}
@@ -20,11 +20,12 @@ func init() {
 }
 
 type GrafanaGraphiteAnnotation struct {
+	conf   *GrafanaGraphiteAnnotationConfig
 	client *graphite.Graphite
 }
 
 type GrafanaGraphiteAnnotationConfig struct {
-	Host string `json:"host"`
+	Host string `json:"host" schema:"required"`
 	Port int    `json:"port"`
 }
 
@@ -49,7 +50,13 @@ func (g *GrafanaGraphiteAnnotation) Init(i interface{}) error {
 		return fmt.Errorf("Incorrect config type. Expecting GrafanaGraphiteAnnotationConfig not %+v", i)
 	}
 
-	client, err := graphite.NewGraphite(c.Host, c.Port)
+	g.conf = c
+	return nil
+}
+
+// Start connects to graphite
+func (g *GrafanaGraphiteAnnotation) Start() error {
+	client, err := graphite.NewGraphite(g.conf.Host, g.conf.Port)
 	if err != nil {
 		return err
 	}
@@ -57,6 +64,14 @@ func (g *GrafanaGraphiteAnnotation) Init(i interface{}) error {
 	return nil
 }
 
+// Close disconnects from graphite
+func (g *GrafanaGraphiteAnnotation) Close() error {
+	if g.client == nil {
+		return nil
+	}
+	return g.client.Disconnect()
+}
+
 func NewGrafanaGraphite() escalation.Escalation {
 	return &GrafanaGraphiteAnnotation{}
 }
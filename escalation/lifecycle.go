@@ -0,0 +1,138 @@
+package escalation
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// A Starter is an Escalation that does work in the background. Start is called once, after Init,
+// when the escalation is put to use. Init should only check and apply the config
+type Starter interface {
+	Start() error
+}
+
+// A Closer is an Escalation that holds on to resources, such as connections. Close is called once
+// the escalation is no longer used
+type Closer interface {
+	Close() error
+}
+
+// A HealthChecker is an Escalation that can tell if it is able to send incidents
+type HealthChecker interface {
+	Health() error
+}
+
+// Health is the state of a single escalation
+type Health struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+// start the escalation if it works in the background
+func start(e Escalation) error {
+	if s, ok := e.(Starter); ok {
+		return s.Start()
+	}
+	return nil
+}
+
+// take removes the running escalation with the given config from the policy, and returns it with its index.
+// The slot is left nil, and the policy skips it from then on
+func (e *EscalationPolicy) take(raw json.RawMessage) (Escalation, escalationMeta, int, bool) {
+	if e == nil {
+		return nil, escalationMeta{}, 0, false
+	}
+
+	for x, r := range e.Configs {
+		if x >= len(e.Escalations) || e.Escalations[x] == nil {
+			continue
+		}
+
+		if bytes.Equal(r, raw) {
+			esc := e.Escalations[x]
+			e.Escalations[x] = nil
+			return esc, e.describe(x), x, true
+		}
+	}
+
+	return nil, escalationMeta{}, 0, false
+}
+
+// takenFrom returns true if the escalation is one of the taken escalations
+func takenFrom(taken map[int]Escalation, esc Escalation) bool {
+	for _, t := range taken {
+		if t == esc {
+			return true
+		}
+	}
+
+	return false
+}
+
+// handOver moves the incidents waiting for the next active window to the policy replacing this one
+func (e *EscalationPolicy) handOver(to *EscalationPolicy) {
+	if e == nil || e == to {
+		return
+	}
+
+	e.queueLock.Lock()
+	queue := e.queue
+	e.queue = nil
+	e.queueLock.Unlock()
+
+	for _, i := range queue {
+		to.enqueue(i)
+	}
+}
+
+// Close closes every escalation the policy still holds
+func (e *EscalationPolicy) Close() {
+	for x, esc := range e.Escalations {
+		if esc == nil {
+			continue
+		}
+
+		c, ok := esc.(Closer)
+		if !ok {
+			continue
+		}
+
+		err := c.Close()
+		if err != nil {
+			meta := e.describe(x)
+			logrus.Errorf("Unable to close escalation %s of type %s: %s", meta.Name, meta.Type, err)
+		}
+	}
+}
+
+// Health returns the state of every escalation of the policy. Escalations that can't check their health are assumed healthy
+func (e *EscalationPolicy) Health() []*Health {
+	hs := make([]*Health, 0, len(e.Escalations))
+	for x, esc := range e.Escalations {
+		if esc == nil {
+			continue
+		}
+
+		meta := e.describe(x)
+		h := &Health{
+			Name:    meta.Name,
+			Type:    meta.Type,
+			Healthy: true,
+		}
+
+		if c, ok := esc.(HealthChecker); ok {
+			if err := c.Health(); err != nil {
+				h.Healthy = false
+				h.Error = err.Error()
+			}
+		}
+
+		hs = append(hs, h)
+	}
+
+	return hs
+}
@@ -0,0 +1,173 @@
+package escalation
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/eliothedeman/bangarang/event"
+)
+
+// lifecycleEscalation records its lifecycle
+type lifecycleEscalation struct {
+	conf    *lifecycleConfig
+	started bool
+	closed  bool
+}
+
+type lifecycleConfig struct {
+	Broken bool `json:"broken"`
+}
+
+func (l *lifecycleEscalation) Send(i *event.Incident) error {
+	return nil
+}
+
+func (l *lifecycleEscalation) ConfigStruct() interface{} {
+	return &lifecycleConfig{}
+}
+
+func (l *lifecycleEscalation) Init(i interface{}) error {
+	l.conf = i.(*lifecycleConfig)
+	return nil
+}
+
+func (l *lifecycleEscalation) Start() error {
+	l.started = true
+	return nil
+}
+
+func (l *lifecycleEscalation) Close() error {
+	l.closed = true
+	return nil
+}
+
+func (l *lifecycleEscalation) Health() error {
+	if l.conf.Broken {
+		return errors.New("broken")
+	}
+	return nil
+}
+
+func init() {
+	LoadFactory("lifecycle", func() Escalation {
+		return &lifecycleEscalation{}
+	})
+}
+
+func newLifecyclePolicy(t *testing.T, old *EscalationPolicy, configs ...string) *EscalationPolicy {
+	e := &EscalationPolicy{}
+	for _, c := range configs {
+		e.Configs = append(e.Configs, json.RawMessage(c))
+	}
+
+	err := e.CompileFrom(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return e
+}
+
+func TestCompileFrom(t *testing.T) {
+	kept := `{"type": "lifecycle", "name": "kept"}`
+	removed := `{"type": "lifecycle", "name": "removed"}`
+	old := newLifecyclePolicy(t, nil, kept, removed)
+
+	k := old.Escalations[0].(*lifecycleEscalation)
+	r := old.Escalations[1].(*lifecycleEscalation)
+	if !k.started || !r.started {
+		t.Fatal("Escalations should be started when they are compiled")
+	}
+
+	e := newLifecyclePolicy(t, old, kept, `{"type": "lifecycle", "name": "added"}`)
+	old.Close()
+
+	if e.Escalations[0] != k || k.closed {
+		t.Error("The unchanged escalation should be kept open")
+	}
+
+	if !r.closed {
+		t.Error("The removed escalation should be closed")
+	}
+
+	if a := e.Escalations[1].(*lifecycleEscalation); !a.started || a.closed {
+		t.Error("The added escalation should be started")
+	}
+
+	if e.describe(0).Name != "kept" || e.describe(1).Name != "added" {
+		t.Error(e.meta)
+	}
+}
+
+func TestEscalationHealth(t *testing.T) {
+	e := newLifecyclePolicy(t, nil, `{"type": "lifecycle", "name": "ok"}`, `{"type": "lifecycle", "name": "bad", "broken": true}`)
+	e.Escalations = append(e.Escalations, &countingEscalation{})
+
+	hs := e.Health()
+	if len(hs) != 3 {
+		t.Fatal(hs)
+	}
+
+	if !hs[0].Healthy || hs[1].Healthy || hs[1].Error != "broken" || hs[1].Type != "lifecycle" {
+		t.Error(hs[0], hs[1])
+	}
+
+	if !hs[2].Healthy {
+		t.Error("Escalations that can't check their health are assumed healthy")
+	}
+}
+
+func TestCompileFromError(t *testing.T) {
+	kept := `{"type": "lifecycle", "name": "kept"}`
+	old := newLifecyclePolicy(t, nil, kept)
+	k := old.Escalations[0].(*lifecycleEscalation)
+
+	e := &EscalationPolicy{
+		Configs: []json.RawMessage{
+			json.RawMessage(kept),
+			json.RawMessage(`{"type": "lifecycle", "name": "added"}`),
+			json.RawMessage(`{"type": "unknown", "name": "broken"}`),
+		},
+	}
+
+	if e.CompileFrom(old) == nil {
+		t.Fatal("Expected an error for an unknown escalation type")
+	}
+
+	if old.Escalations[0] != k || k.closed {
+		t.Error("The old policy should get its escalations back")
+	}
+
+	if len(e.Escalations) != 0 {
+		t.Error("The broken policy shouldn't hold any escalations", e.Escalations)
+	}
+}
+
+func TestCompileFromQueue(t *testing.T) {
+	old := newLifecyclePolicy(t, nil, `{"type": "lifecycle", "name": "kept"}`)
+	old.enqueue(event.NewIncident("test", event.CRITICAL, event.NewEvent()))
+
+	e := newLifecyclePolicy(t, old, `{"type": "lifecycle", "name": "kept"}`)
+	if len(e.queue) != 1 || len(old.queue) != 0 {
+		t.Error("Held incidents should move to the new policy", e.queue, old.queue)
+	}
+}
+
+func TestSendAfterCompileFrom(t *testing.T) {
+	kept := `{"type": "lifecycle", "name": "kept"}`
+	old := newLifecyclePolicy(t, nil, kept, `{"type": "lifecycle", "name": "removed"}`)
+	newLifecyclePolicy(t, old, kept)
+
+	// the old policy may still be in use while it is replaced
+	ds := old.Test(event.NewIncident("test", event.CRITICAL, event.NewEvent()))
+	if len(ds) != 1 || ds[0].Escalation != "removed" {
+		t.Error(ds)
+	}
+
+	if hs := old.Health(); len(hs) != 1 || hs[0].Name != "removed" {
+		t.Error(hs)
+	}
+
+	old.Close()
+}
@@ -1,10 +1,27 @@
 package pd
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
 	"github.com/Sirupsen/logrus"
 	"github.com/eliothedeman/bangarang/escalation"
 	"github.com/eliothedeman/bangarang/event"
-	"github.com/marcw/pagerduty"
+)
+
+const (
+	DEFAULT_URL     = "https://events.pagerduty.com/v2/enqueue"
+	DEFAULT_SOURCE  = "bangarang"
+	DEFAULT_TIMEOUT = "10s"
+	CLIENT_NAME     = "bangarang"
+
+	ACTION_TRIGGER     = "trigger"
+	ACTION_ACKNOWLEDGE = "acknowledge"
+	ACTION_RESOLVE     = "resolve"
 )
 
 func init() {
@@ -12,12 +29,21 @@ func init() {
 }
 
 type PagerDuty struct {
-	conf *PagerDutyConfig
+	sync.Mutex
+	conf   *PagerDutyConfig
+	client *http.Client
+
+	// the dedup key of every incident triggered and not yet resolved, and whether it has been acknowledged
+	open map[string]bool
 }
 
 func NewPagerduty() escalation.Escalation {
 	p := &PagerDuty{
-		conf: &PagerDutyConfig{},
+		conf: &PagerDutyConfig{
+			URL:     DEFAULT_URL,
+			Timeout: DEFAULT_TIMEOUT,
+		},
+		open: make(map[string]bool),
 	}
 	return p
 }
@@ -28,24 +54,218 @@ func (p *PagerDuty) ConfigStruct() interface{} {
 
 func (p *PagerDuty) Init(conf interface{}) error {
 	logrus.Info("Initilizing pager duty escalation.")
+	c, ok := conf.(*PagerDutyConfig)
+	if !ok {
+		return fmt.Errorf("Incorrect config type. Expecting PagerDutyConfig not %+v", conf)
+	}
+
+	if c.Key == "" {
+		return fmt.Errorf("A routing key must be provided for pager duty")
+	}
+
+	timeout, err := time.ParseDuration(c.Timeout)
+	if err != nil {
+		return err
+	}
+
+	p.conf = c
+	p.client = &http.Client{
+		Timeout: timeout,
+	}
+
 	return nil
 }
 
-func (p *PagerDuty) Send(i *event.Incident) error {
-	var pdPevent *pagerduty.Event
+// Event is a pager duty events api v2 request
+type Event struct {
+	RoutingKey  string   `json:"routing_key"`
+	EventAction string   `json:"event_action"`
+	DedupKey    string   `json:"dedup_key"`
+	Payload     *Payload `json:"payload,omitempty"`
+	Client      string   `json:"client,omitempty"`
+	ClientURL   string   `json:"client_url,omitempty"`
+	Links       []*Link  `json:"links,omitempty"`
+}
+
+// Link is shown to responders on the pager duty incident
+type Link struct {
+	Href string `json:"href"`
+	Text string `json:"text"`
+}
+
+// Payload describes the incident being triggered
+type Payload struct {
+	Summary       string                 `json:"summary"`
+	Source        string                 `json:"source"`
+	Severity      string                 `json:"severity"`
+	Timestamp     string                 `json:"timestamp,omitempty"`
+	Component     string                 `json:"component,omitempty"`
+	Class         string                 `json:"class,omitempty"`
+	CustomDetails map[string]interface{} `json:"custom_details,omitempty"`
+}
+
+// the response from the events api
+type response struct {
+	Status   string   `json:"status"`
+	Message  string   `json:"message"`
+	DedupKey string   `json:"dedup_key"`
+	Errors   []string `json:"errors"`
+}
+
+// severity maps an incident status to a pager duty severity
+func severity(status int) string {
+	switch status {
+	case event.CRITICAL:
+		return "critical"
+	case event.WARNING:
+		return "warning"
+	default:
+		return "info"
+	}
+}
+
+// action returns the event action for the incident. Only an incident which has already been triggered can be acknowledged
+func (p *PagerDuty) action(i *event.Incident, open bool) string {
 	switch i.Status {
-	case event.CRITICAL, event.WARNING:
-		pdPevent = pagerduty.NewTriggerEvent(p.conf.Key, i.FormatDescription())
 	case event.OK:
-		pdPevent = pagerduty.NewResolveEvent(p.conf.Key, i.FormatDescription())
+		return ACTION_RESOLVE
+	case event.WARNING:
+		if p.conf.AcknowledgeWarnings && open {
+			return ACTION_ACKNOWLEDGE
+		}
+	}
+
+	return ACTION_TRIGGER
+}
+
+// newEvent creates the events api request for the incident and action
+func (p *PagerDuty) newEvent(i *event.Incident, action string) *Event {
+	e := &Event{
+		RoutingKey:  p.conf.Key,
+		EventAction: action,
+		DedupKey:    string(i.IndexName()),
+		Client:      CLIENT_NAME,
+	}
+
+	if p.conf.Subdomain != "" {
+		e.ClientURL = fmt.Sprintf("https://%s.pagerduty.com/incidents", p.conf.Subdomain)
+	}
+
+	// only triggers describe the incident
+	if action != ACTION_TRIGGER {
+		return e
 	}
-	pdPevent.IncidentKey = string(string(i.IndexName()))
 
-	_, _, err := pagerduty.Submit(pdPevent)
-	return err
+	source := i.Tags.Get("host")
+	if source == "" {
+		source = DEFAULT_SOURCE
+	}
+
+	details := map[string]interface{}{
+		"metric": i.Metric,
+		"policy": i.Policy,
+	}
+	i.Tags.ForEach(func(k, v string) {
+		details[k] = v
+	})
+
+	for k, v := range i.Annotations {
+		details[k] = v
+	}
+
+	// annotations which point somewhere are links
+	for _, k := range []string{escalation.ANNOTATION_RUNBOOK_URL, escalation.ANNOTATION_DASHBOARD_URL} {
+		if href := i.Annotations[k]; href != "" {
+			e.Links = append(e.Links, &Link{
+				Href: href,
+				Text: k,
+			})
+		}
+	}
+
+	summary := i.Description
+	if summary == "" {
+		summary = i.FormatDescription()
+	}
+
+	e.Payload = &Payload{
+		Summary:       summary,
+		Source:        source,
+		Severity:      severity(i.Status),
+		Timestamp:     time.Unix(i.Time, 0).UTC().Format(time.RFC3339),
+		Component:     i.Tags.Get("service"),
+		Class:         i.Policy,
+		CustomDetails: details,
+	}
+
+	return e
+}
+
+// Send the incident to pager duty
+func (p *PagerDuty) Send(i *event.Incident) error {
+	key := string(i.IndexName())
+	p.Lock()
+	acked, open := p.open[key]
+	p.Unlock()
+
+	action := p.action(i, open)
+
+	// triggering an acknowledged incident doesn't notify anyone, so resolve it and trigger a new one
+	if action == ACTION_TRIGGER && acked {
+		err := p.submit(p.newEvent(i, ACTION_RESOLVE))
+		if err != nil {
+			return err
+		}
+	}
+
+	err := p.submit(p.newEvent(i, action))
+	if err != nil {
+		return err
+	}
+
+	p.Lock()
+	switch action {
+	case ACTION_TRIGGER:
+		p.open[key] = false
+	case ACTION_ACKNOWLEDGE:
+		p.open[key] = true
+	case ACTION_RESOLVE:
+		delete(p.open, key)
+	}
+	p.Unlock()
+
+	return nil
+}
+
+// submit the event to the events api
+func (p *PagerDuty) submit(e *Event) error {
+	buff, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Post(p.conf.URL, "application/json", bytes.NewReader(buff))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// the body only matters when the event was rejected
+	if resp.StatusCode == http.StatusAccepted {
+		return nil
+	}
+
+	r := &response{}
+	json.NewDecoder(resp.Body).Decode(r)
+	return fmt.Errorf("Pager duty returned %s: %s %v", resp.Status, r.Message, r.Errors)
 }
 
 type PagerDutyConfig struct {
 	Subdomain string `json:"subdomain"`
-	Key       string `json:"key"`
+	Key       string `json:"key" schema:"required,secret"`
+	URL       string `json:"url"`
+	Timeout   string `json:"timeout"`
+
+	// acknowledge an incident already triggered when it drops to a warning, instead of triggering again at warning severity
+	AcknowledgeWarnings bool `json:"acknowledge_warnings"`
 }
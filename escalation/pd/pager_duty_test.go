@@ -0,0 +1,215 @@
+package pd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eliothedeman/bangarang/escalation"
+	"github.com/eliothedeman/bangarang/event"
+)
+
+// a stand in for the events api that records every event it is sent
+func newTestServer(code int) (*httptest.Server, chan *Event) {
+	events := make(chan *Event, 10)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := &Event{}
+		json.NewDecoder(r.Body).Decode(e)
+		events <- e
+		w.WriteHeader(code)
+		w.Write([]byte(`{"status": "success", "message": "Event processed"}`))
+	}))
+
+	return s, events
+}
+
+func newTestPagerDuty(t *testing.T, url string, ack bool) *PagerDuty {
+	p := NewPagerduty().(*PagerDuty)
+	c := p.ConfigStruct().(*PagerDutyConfig)
+	c.Key = "test_key"
+	c.URL = url
+	c.Subdomain = "test"
+	c.AcknowledgeWarnings = ack
+	err := p.Init(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func newTestIncident(status int) *event.Incident {
+	e := event.NewEvent()
+	e.Tags.Set("host", "test.com")
+	e.Tags.Set("service", "cpu")
+	e.Metric = 95
+	return event.NewIncident("cpu_high", status, e)
+}
+
+func TestSeverity(t *testing.T) {
+	s, events := newTestServer(http.StatusAccepted)
+	defer s.Close()
+	p := newTestPagerDuty(t, s.URL, false)
+
+	in := newTestIncident(event.WARNING)
+	err := p.Send(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := <-events
+	if e.EventAction != ACTION_TRIGGER || e.Payload.Severity != "warning" {
+		t.Error(e.EventAction, e.Payload.Severity)
+	}
+
+	if e.RoutingKey != "test_key" || e.DedupKey != string(in.IndexName()) {
+		t.Error(e.RoutingKey, e.DedupKey)
+	}
+
+	if e.ClientURL != "https://test.pagerduty.com/incidents" {
+		t.Error(e.ClientURL)
+	}
+
+	if e.Payload.Source != "test.com" || e.Payload.CustomDetails["service"] != "cpu" {
+		t.Error(e.Payload)
+	}
+
+	err = p.Send(newTestIncident(event.CRITICAL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e = <-events
+	if e.Payload.Severity != "critical" {
+		t.Error(e.Payload.Severity)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	s, events := newTestServer(http.StatusAccepted)
+	defer s.Close()
+	p := newTestPagerDuty(t, s.URL, false)
+
+	err := p.Send(newTestIncident(event.OK))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := <-events
+	if e.EventAction != ACTION_RESOLVE || e.Payload != nil {
+		t.Error(e)
+	}
+}
+
+func TestAcknowledgeWarnings(t *testing.T) {
+	s, events := newTestServer(http.StatusAccepted)
+	defer s.Close()
+	p := newTestPagerDuty(t, s.URL, true)
+
+	// nothing has been triggered yet, so there is nothing to acknowledge
+	err := p.Send(newTestIncident(event.WARNING))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := <-events
+	if e.EventAction != ACTION_TRIGGER || e.Payload.Severity != "warning" {
+		t.Error(e.EventAction, e.Payload)
+	}
+
+	err = p.Send(newTestIncident(event.WARNING))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e = <-events
+	if e.EventAction != ACTION_ACKNOWLEDGE {
+		t.Error(e.EventAction)
+	}
+}
+
+func TestCriticalAfterAcknowledge(t *testing.T) {
+	s, events := newTestServer(http.StatusAccepted)
+	defer s.Close()
+	p := newTestPagerDuty(t, s.URL, true)
+
+	for _, status := range []int{event.CRITICAL, event.WARNING, event.CRITICAL} {
+		err := p.Send(newTestIncident(status))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the acknowledged incident is resolved, so the second critical notifies again
+	for _, action := range []string{ACTION_TRIGGER, ACTION_ACKNOWLEDGE, ACTION_RESOLVE, ACTION_TRIGGER} {
+		e := <-events
+		if e.EventAction != action {
+			t.Error(action, e.EventAction)
+		}
+	}
+
+	// once resolved, a warning is a new incident
+	err := p.Send(newTestIncident(event.OK))
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-events
+
+	err = p.Send(newTestIncident(event.WARNING))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := <-events
+	if e.EventAction != ACTION_TRIGGER {
+		t.Error(e.EventAction)
+	}
+}
+
+func TestSendError(t *testing.T) {
+	s, _ := newTestServer(http.StatusBadRequest)
+	defer s.Close()
+	p := newTestPagerDuty(t, s.URL, false)
+
+	if p.Send(newTestIncident(event.CRITICAL)) == nil {
+		t.Fatal("Expected an error for a rejected event")
+	}
+}
+
+func TestAnnotationLinks(t *testing.T) {
+	s, events := newTestServer(http.StatusAccepted)
+	defer s.Close()
+	p := newTestPagerDuty(t, s.URL, false)
+
+	in := newTestIncident(event.CRITICAL)
+	in.Annotations = map[string]string{
+		escalation.ANNOTATION_RUNBOOK_URL: "http://runbooks/cpu",
+		escalation.ANNOTATION_OWNER:       "ops",
+	}
+	err := p.Send(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := <-events
+	if len(e.Links) != 1 || e.Links[0].Href != "http://runbooks/cpu" {
+		t.Error(e.Links)
+	}
+
+	if e.Payload.CustomDetails[escalation.ANNOTATION_OWNER] != "ops" {
+		t.Error(e.Payload.CustomDetails)
+	}
+}
+
+func TestSendEmptyResponse(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer s.Close()
+	p := newTestPagerDuty(t, s.URL, false)
+
+	err := p.Send(newTestIncident(event.CRITICAL))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -3,6 +3,7 @@ package escalation
 import (
 	"log"
 	"regexp"
+	"text/template"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -22,19 +23,30 @@ var (
 )
 
 type Policy struct {
-	Match       *event.TagSet `json:"match"`
-	NotMatch    *event.TagSet `json:"not_match"`
-	GroupBy     *event.TagSet `json:"group_by"`
-	Crit        *Condition    `json:"crit"`
-	Warn        *Condition    `json:"warn"`
-	Name        string        `json:"name"`
-	Comment     string        `json:"comment"`
-	next        event.IncidentPasser
-	r_match     Matcher
-	r_not_match Matcher
-	stop        chan struct{}
-	in          chan *event.Event
-	resolve     chan *event.Incident
+	Match      *event.TagSet `json:"match"`
+	NotMatch   *event.TagSet `json:"not_match"`
+	GroupBy    *event.TagSet `json:"group_by"`
+	Crit       *Condition    `json:"crit"`
+	Warn       *Condition    `json:"warn"`
+	Name       string        `json:"name"`
+	Comment    string        `json:"comment"`
+	RunbookURL string        `json:"runbook_url"`
+
+	// templates used to describe the incidents this policy creates, optionally per status name
+	Description        string            `json:"description"`
+	StatusDescriptions map[string]string `json:"status_descriptions"`
+
+	// copied into every incident this policy creates
+	Annotations *Annotations `json:"annotations"`
+
+	next         event.IncidentPasser
+	r_match      Matcher
+	r_not_match  Matcher
+	descriptions *descriptionTemplates
+	annotations  map[string]*template.Template
+	stop         chan struct{}
+	in           chan *event.Event
+	resolve      chan *event.Incident
 }
 
 // start the policy listening for events
@@ -92,16 +104,14 @@ func (p *Policy) start() {
 
 					// check critical
 					if shouldAlert, status := p.ActionCrit(e); shouldAlert {
-						incident := event.NewIncident(p.Name, status, e)
-						incident.SetResolve(p.resolve)
+						incident := p.newIncident(status, e)
 
 						// send send it off to the next hop
 						p.next.PassIncident(incident)
 
 						// check warning
 					} else if shouldAlert, status := p.ActionWarn(e); shouldAlert {
-						incident := event.NewIncident(p.Name, status, e)
-						incident.SetResolve(p.resolve)
+						incident := p.newIncident(status, e)
 
 						// send it off to the next hop
 						p.next.PassIncident(incident)
@@ -255,6 +265,17 @@ func (p *Policy) Compile(next event.IncidentPasser) {
 		i += 1
 	})
 
+	var err error
+	p.descriptions, err = p.compileDescriptions()
+	if err != nil {
+		logrus.Errorf("Unable to compile description for %s: %s", p.Name, err.Error())
+	}
+
+	p.annotations, err = p.compileAnnotations()
+	if err != nil {
+		logrus.Errorf("Unable to compile annotations for %s: %s", p.Name, err.Error())
+	}
+
 	if p.Crit != nil {
 		logrus.Infof("Initializing crit for %s", p.Name)
 		p.Crit.init(p.GroupBy)
@@ -268,6 +289,31 @@ func (p *Policy) Compile(next event.IncidentPasser) {
 	p.start()
 }
 
+// Validate returns an error if any part of the policy is unable to be compiled
+func (p *Policy) Validate() error {
+	if p.Match != nil {
+		_, err := MatcherFromTagSet(p.Match)
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.NotMatch != nil {
+		_, err := MatcherFromTagSet(p.NotMatch)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := p.compileDescriptions()
+	if err != nil {
+		return err
+	}
+
+	_, err = p.compileAnnotations()
+	return err
+}
+
 // ActionCrit returns the state change and the current status of the event
 func (p *Policy) ActionCrit(e *event.Event) (bool, int) {
 	status := event.OK
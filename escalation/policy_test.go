@@ -177,3 +177,111 @@ func TestCompileSatisfies(t *testing.T) {
 	}
 
 }
+
+func TestDescriptionTemplate(t *testing.T) {
+	p := &Policy{
+		Name:        "load",
+		Comment:     "load is too high",
+		RunbookURL:  "http://runbooks/load",
+		Description: `{{.Tags.Get "host"}} {{status .Status}} at {{.Metric}} > {{.Condition.Greater}} ({{.Comment}}) {{.RunbookURL}}`,
+		StatusDescriptions: map[string]string{
+			"ok": `{{.Tags.Get "host"}} recovered`,
+		},
+		Crit: &Condition{
+			Greater: test_f(10),
+		},
+	}
+	p.Compile(newTestPasser())
+
+	e := newTestEvent("test.com", "load", 15)
+	in := p.newIncident(event.CRITICAL, e)
+	if in.Description != "test.com critical at 15 > 10 (load is too high) http://runbooks/load" {
+		t.Error(in.Description)
+	}
+
+	in = p.newIncident(event.OK, e)
+	if in.Description != "test.com recovered" {
+		t.Error(in.Description)
+	}
+}
+
+func TestDescriptionDefault(t *testing.T) {
+	p := &Policy{
+		Name: "load",
+		StatusDescriptions: map[string]string{
+			"ok": "recovered",
+		},
+	}
+	p.Compile(newTestPasser())
+
+	in := p.newIncident(event.WARNING, newTestEvent("test.com", "load", 15))
+	if in.Description != event.DefaultIncidentFormatter(in) {
+		t.Error(in.Description)
+	}
+}
+
+func TestValidateDescription(t *testing.T) {
+	p := &Policy{
+		Description: "{{.Tags",
+	}
+	if p.Validate() == nil {
+		t.Error("Expected an error for an invalid template")
+	}
+
+	p = &Policy{
+		StatusDescriptions: map[string]string{
+			"bad": "hello",
+		},
+	}
+	if p.Validate() == nil {
+		t.Error("Expected an error for an unknown status")
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	p := &Policy{
+		Name:       "load",
+		RunbookURL: "http://runbooks/load",
+		Annotations: &Annotations{
+			DashboardURL: `http://dashboards/{{.Tags.Get "host"}}`,
+			Owner:        "ops",
+			Extra: map[string]string{
+				"status": "{{status .Status}}",
+			},
+		},
+		Description: `{{.Annotations.owner}} {{.Annotations.dashboard_url}}`,
+	}
+	p.Compile(newTestPasser())
+
+	in := p.newIncident(event.CRITICAL, newTestEvent("test.com", "load", 15))
+	expected := map[string]string{
+		ANNOTATION_RUNBOOK_URL:   "http://runbooks/load",
+		ANNOTATION_DASHBOARD_URL: "http://dashboards/test.com",
+		ANNOTATION_OWNER:         "ops",
+		"status":                 "critical",
+	}
+	if len(in.Annotations) != len(expected) {
+		t.Error(in.Annotations)
+	}
+
+	for k, v := range expected {
+		if in.Annotations[k] != v {
+			t.Errorf("%s: expected %s got %s", k, v, in.Annotations[k])
+		}
+	}
+
+	if in.Description != "ops http://dashboards/test.com" {
+		t.Error(in.Description)
+	}
+}
+
+func TestValidateAnnotations(t *testing.T) {
+	p := &Policy{
+		Annotations: &Annotations{
+			Owner: "{{.Tags",
+		},
+	}
+	if p.Validate() == nil {
+		t.Error("Expected an error for an invalid template")
+	}
+}
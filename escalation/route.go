@@ -0,0 +1,336 @@
+package escalation
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/eliothedeman/bangarang/event"
+)
+
+const (
+	ROOT_ROUTE_NAME = "root"
+)
+
+// Route sends incidents to escalation policies by their tags. Routes form a tree: an incident
+// walks into the first child that matches it, and keeps checking the following children only
+// while the matched child sets continue. An incident that matches none of the children stops at
+// the parent, which makes the root the default route. The root can't have match or not_match.
+//
+// With a repeat_interval, incidents with the same values for the group_by tags are batched: the
+// first incident of a group is sent right away, and the incidents that follow it are held until
+// the interval has passed, then sent together.
+//
+// Escalations, group_by, and repeat_interval are inherited from the parent when they are not set.
+type Route struct {
+	Name        string        `json:"name"`
+	Match       *event.TagSet `json:"match"`
+	NotMatch    *event.TagSet `json:"not_match"`
+	Escalations []string      `json:"escalations"`
+	Continue    bool          `json:"continue"`
+
+	// incidents with the same values for these tags are sent together, at most once per repeat interval
+	GroupBy        []string `json:"group_by"`
+	RepeatInterval string   `json:"repeat_interval"`
+
+	Routes []*Route `json:"routes"`
+
+	id             string
+	rMatch         Matcher
+	rNotMatch      Matcher
+	escalations    []string
+	groupBy        []string
+	repeatInterval time.Duration
+
+	// the incidents sent and held for each group
+	groups map[string]*routeGroup
+	sync.Mutex
+}
+
+// routeGroup is a group of incidents that are sent together
+type routeGroup struct {
+	// when the group was last sent
+	time time.Time
+
+	// the status of each incident when the group was last sent, by index name
+	sent map[string]int
+
+	// incidents waiting for the repeat interval to pass
+	held []*event.Incident
+}
+
+// hold keeps the incident until the group is next sent, replacing any held update of the same incident
+func (g *routeGroup) hold(i *event.Incident) {
+	name := string(i.IndexName())
+	for x, h := range g.held {
+		if string(h.IndexName()) == name {
+			g.held[x] = i
+			return
+		}
+	}
+
+	g.held = append(g.held, i)
+}
+
+// send starts a new interval for the group, and returns the incidents to send
+func (g *routeGroup) send(now time.Time) []*event.Incident {
+	batch := g.held
+	g.held = nil
+	g.time = now
+	g.sent = make(map[string]int, len(batch))
+	for _, i := range batch {
+		g.sent[string(i.IndexName())] = i.Status
+	}
+
+	return batch
+}
+
+// Compile compiles the matchers of the route and all of its children, and resolves the inherited settings
+func (r *Route) Compile() error {
+	return r.CompileFrom(nil)
+}
+
+// CompileFrom compiles the route, and takes over the groups of the routes with the same ids in
+// the old tree, so incidents that are held or were just sent aren't forgotten when the tree is
+// changed. Use Drain on the old tree afterwards to send what was held by routes that are gone
+func (r *Route) CompileFrom(old *Route) error {
+	if r.Match != nil || r.NotMatch != nil {
+		return fmt.Errorf("Route %s: the root route receives every incident, and can't have match or not_match", ROOT_ROUTE_NAME)
+	}
+
+	err := r.compile(nil, ROOT_ROUTE_NAME)
+	if err != nil || old == nil {
+		return err
+	}
+
+	olds := make(map[string]*Route)
+	old.walk(func(o *Route) {
+		olds[o.id] = o
+	})
+
+	r.walk(func(n *Route) {
+		o, ok := olds[n.id]
+		if !ok || o == n {
+			return
+		}
+
+		o.Lock()
+		groups := o.groups
+		o.groups = make(map[string]*routeGroup)
+		o.Unlock()
+
+		n.Lock()
+		n.groups = groups
+		n.Unlock()
+	})
+
+	return nil
+}
+
+// walk calls f for the route and every route below it
+func (r *Route) walk(f func(r *Route)) {
+	f(r)
+	for _, c := range r.Routes {
+		c.walk(f)
+	}
+}
+
+func (r *Route) compile(parent *Route, id string) (err error) {
+	r.id = id
+	if r.Name != "" {
+		r.id = r.Name
+	}
+
+	r.rMatch, r.rNotMatch = nil, nil
+	if r.Match != nil {
+		r.rMatch, err = MatcherFromTagSet(r.Match)
+		if err != nil {
+			return fmt.Errorf("Route %s: %s", r.id, err)
+		}
+	}
+
+	if r.NotMatch != nil {
+		r.rNotMatch, err = MatcherFromTagSet(r.NotMatch)
+		if err != nil {
+			return fmt.Errorf("Route %s: %s", r.id, err)
+		}
+	}
+
+	r.escalations = r.Escalations
+	r.groupBy = r.GroupBy
+	r.repeatInterval = 0
+	if r.RepeatInterval != "" {
+		r.repeatInterval, err = time.ParseDuration(r.RepeatInterval)
+		if err != nil {
+			return fmt.Errorf("Route %s: %s", r.id, err)
+		}
+	}
+
+	// inherit anything that isn't set from the parent
+	if parent != nil {
+		if r.escalations == nil {
+			r.escalations = parent.escalations
+		}
+
+		if r.groupBy == nil {
+			r.groupBy = parent.groupBy
+		}
+
+		if r.RepeatInterval == "" {
+			r.repeatInterval = parent.repeatInterval
+		}
+	}
+
+	r.Lock()
+	if r.groups == nil {
+		r.groups = make(map[string]*routeGroup)
+	}
+	r.Unlock()
+
+	for x, c := range r.Routes {
+		err = c.compile(r, fmt.Sprintf("%s.%d", id, x))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ID returns the name of the route, or its position in the tree if it has no name
+func (r *Route) ID() string {
+	return r.id
+}
+
+// Targets returns the names of the escalation policies the route sends to
+func (r *Route) Targets() []string {
+	return r.escalations
+}
+
+// Grouping returns the tags the route groups incidents by, and how often a group is notified
+func (r *Route) Grouping() ([]string, time.Duration) {
+	return r.groupBy, r.repeatInterval
+}
+
+// matches returns true if the route accepts incidents with the given tags
+func (r *Route) matches(t *event.TagSet) bool {
+	return r.rMatch.MatchesAll(t) && !r.rNotMatch.MatchesOne(t)
+}
+
+// Find returns every route that incidents with the given tags end up at
+func (r *Route) Find(t *event.TagSet) []*Route {
+	if !r.matches(t) {
+		return nil
+	}
+
+	var found []*Route
+	for _, c := range r.Routes {
+		m := c.Find(t)
+		if len(m) == 0 {
+			continue
+		}
+
+		found = append(found, m...)
+		if !c.Continue {
+			break
+		}
+	}
+
+	// no child wanted it, so it stops here
+	if len(found) == 0 {
+		return []*Route{r}
+	}
+
+	return found
+}
+
+// groupKey returns the group the incident belongs to. Without group_by, every incident is its own group
+func (r *Route) groupKey(i *event.Incident) string {
+	if len(r.groupBy) == 0 {
+		return string(i.IndexName())
+	}
+
+	buff := bytes.NewBufferString(i.Policy)
+	for _, k := range r.groupBy {
+		fmt.Fprintf(buff, ",%s=%s", k, i.Tags.Get(k))
+	}
+
+	return buff.String()
+}
+
+// Batch returns the incidents the route should send now. The first incident of a group is sent
+// right away. Until the repeat interval has passed, incidents that follow it in the same group
+// are held, and repeats of an incident that was already sent with the same status are ignored
+func (r *Route) Batch(i *event.Incident, now time.Time) []*event.Incident {
+	if r.repeatInterval == 0 {
+		return []*event.Incident{i}
+	}
+
+	key := r.groupKey(i)
+
+	r.Lock()
+	defer r.Unlock()
+
+	g, ok := r.groups[key]
+	if !ok {
+		g = &routeGroup{}
+		r.groups[key] = g
+	}
+
+	if ok && now.Sub(g.time) < r.repeatInterval {
+		if status, sent := g.sent[string(i.IndexName())]; !sent || status != i.Status {
+			g.hold(i)
+		}
+		return nil
+	}
+
+	g.hold(i)
+	return g.send(now)
+}
+
+// Due calls f with the held incidents of each group, in this route and every route below it,
+// whose repeat interval has passed
+func (r *Route) Due(now time.Time, f func(r *Route, batch []*event.Incident)) {
+	r.flush(f, func(g *routeGroup) bool {
+		return now.Sub(g.time) >= r.repeatInterval
+	}, now)
+
+	for _, c := range r.Routes {
+		c.Due(now, f)
+	}
+}
+
+// Drain calls f with every held incident, in this route and every route below it, whatever their repeat interval
+func (r *Route) Drain(f func(r *Route, batch []*event.Incident)) {
+	now := time.Now()
+	r.walk(func(n *Route) {
+		n.flush(f, func(*routeGroup) bool {
+			return true
+		}, now)
+	})
+}
+
+// flush sends the held incidents of the groups that are ready, and forgets the groups that have
+// nothing held and have been quiet for longer than the interval
+func (r *Route) flush(f func(r *Route, batch []*event.Incident), ready func(g *routeGroup) bool, now time.Time) {
+	r.Lock()
+	var batches [][]*event.Incident
+	for k, g := range r.groups {
+		if !ready(g) {
+			continue
+		}
+
+		if len(g.held) == 0 {
+			delete(r.groups, k)
+			continue
+		}
+
+		batches = append(batches, g.send(now))
+	}
+	r.Unlock()
+
+	for _, b := range batches {
+		f(r, b)
+	}
+}
@@ -0,0 +1,240 @@
+package escalation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eliothedeman/bangarang/event"
+)
+
+func newTestRoute(t *testing.T) *Route {
+	db := event.NewTagset(0)
+	db.Set("service", "db")
+
+	web := event.NewTagset(0)
+	web.Set("service", "web")
+
+	prod := event.NewTagset(0)
+	prod.Set("env", "prod")
+
+	r := &Route{
+		Escalations: []string{"default"},
+		GroupBy:     []string{"service"},
+		Routes: []*Route{
+			{
+				Name:        "audit",
+				Match:       event.NewTagset(0),
+				Escalations: []string{"audit"},
+				Continue:    true,
+			},
+			{
+				Match:          db,
+				Escalations:    []string{"dba"},
+				RepeatInterval: "1h",
+				Routes: []*Route{
+					{
+						Name:        "db_prod",
+						Match:       prod,
+						Escalations: []string{"pager"},
+					},
+				},
+			},
+			{
+				Match:       web,
+				Escalations: []string{"web"},
+			},
+		},
+	}
+
+	err := r.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func findRoutes(r *Route, kv ...string) []string {
+	tags := event.NewTagset(0)
+	for i := 0; i < len(kv); i += 2 {
+		tags.Set(kv[i], kv[i+1])
+	}
+
+	var ids []string
+	for _, f := range r.Find(tags) {
+		ids = append(ids, f.ID())
+	}
+	return ids
+}
+
+func TestRouteFind(t *testing.T) {
+	r := newTestRoute(t)
+
+	tests := []struct {
+		tags     []string
+		expected []string
+	}{
+		{[]string{"service", "db"}, []string{"audit", "root.1"}},
+		{[]string{"service", "db", "env", "prod"}, []string{"audit", "db_prod"}},
+		{[]string{"service", "web", "env", "prod"}, []string{"audit", "root.2"}},
+	}
+
+	for _, test := range tests {
+		found := findRoutes(r, test.tags...)
+		if len(found) != len(test.expected) {
+			t.Errorf("%v: expected %v got %v", test.tags, test.expected, found)
+			continue
+		}
+
+		for i := range found {
+			if found[i] != test.expected[i] {
+				t.Errorf("%v: expected %v got %v", test.tags, test.expected, found)
+			}
+		}
+	}
+}
+
+func TestRouteDefault(t *testing.T) {
+	r := newTestRoute(t)
+
+	// the audit route continues, and nothing else matches, so the incident stops at the root
+	r.Routes = r.Routes[1:]
+	found := findRoutes(r, "service", "cache")
+	if len(found) != 1 || found[0] != ROOT_ROUTE_NAME {
+		t.Error(found)
+	}
+
+	if r.Targets()[0] != "default" {
+		t.Error(r.Targets())
+	}
+}
+
+func TestRouteInherit(t *testing.T) {
+	r := newTestRoute(t)
+	prod := r.Routes[1].Routes[0]
+
+	if prod.Targets()[0] != "pager" {
+		t.Error(prod.Targets())
+	}
+
+	groupBy, interval := prod.Grouping()
+	if len(groupBy) != 1 || groupBy[0] != "service" || interval.Hours() != 1 {
+		t.Error(groupBy, interval)
+	}
+}
+
+func newGroupedIncident(host string, status int) *event.Incident {
+	e := event.NewEvent()
+	e.Tags.Set("host", host)
+	e.Tags.Set("service", "db")
+	return event.NewIncident("test", status, e)
+}
+
+func TestRouteBatch(t *testing.T) {
+	r := newTestRoute(t).Routes[1]
+	now := time.Now()
+
+	if len(r.Batch(newGroupedIncident("a", event.CRITICAL), now)) != 1 {
+		t.Fatal("The first incident of a group should be sent")
+	}
+
+	// a repeat of what was just sent is ignored
+	if len(r.Batch(newGroupedIncident("a", event.CRITICAL), now)) != 0 {
+		t.Fatal("The repeat should be ignored")
+	}
+
+	// new incidents and changes in the same group are held, not dropped
+	if len(r.Batch(newGroupedIncident("b", event.CRITICAL), now)) != 0 {
+		t.Fatal("The group was already sent")
+	}
+
+	if len(r.Batch(newGroupedIncident("a", event.OK), now)) != 0 {
+		t.Fatal("The group was already sent")
+	}
+
+	var held []*event.Incident
+	collect := func(_ *Route, batch []*event.Incident) {
+		held = append(held, batch...)
+	}
+
+	r.Due(now.Add(time.Minute), collect)
+	if len(held) != 0 {
+		t.Fatal("Nothing should be sent before the interval has passed", held)
+	}
+
+	r.Due(now.Add(time.Hour), collect)
+	if len(held) != 2 || held[0].Tags.Get("host") != "b" || held[1].Status != event.OK {
+		t.Fatal(held)
+	}
+}
+
+func TestRouteCompileFrom(t *testing.T) {
+	old := newTestRoute(t)
+	now := time.Now()
+	old.Routes[1].Batch(newGroupedIncident("a", event.CRITICAL), now)
+	old.Routes[1].Batch(newGroupedIncident("b", event.CRITICAL), now)
+
+	// the same tree, loaded again
+	r := newTestRoute(t)
+	err := r.CompileFrom(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.Routes[1].Batch(newGroupedIncident("a", event.CRITICAL), now)) != 0 {
+		t.Fatal("The group should have been kept")
+	}
+
+	var drained []*event.Incident
+	old.Drain(func(_ *Route, batch []*event.Incident) {
+		drained = append(drained, batch...)
+	})
+
+	if len(drained) != 0 {
+		t.Fatal("The held incidents should belong to the new tree", drained)
+	}
+
+	var held []*event.Incident
+	r.Drain(func(_ *Route, batch []*event.Incident) {
+		held = append(held, batch...)
+	})
+
+	if len(held) != 1 || held[0].Tags.Get("host") != "b" {
+		t.Fatal(held)
+	}
+}
+
+func TestRouteRootMatch(t *testing.T) {
+	r := newTestRoute(t)
+	r.Match = event.NewTagset(0)
+	r.Match.Set("service", "db")
+
+	if r.Compile() == nil {
+		t.Error("Expected an error for a root route with match")
+	}
+}
+
+func TestRouteCompileError(t *testing.T) {
+	bad := event.NewTagset(0)
+	bad.Set("host", "(")
+
+	r := &Route{
+		Routes: []*Route{
+			{
+				Match: bad,
+			},
+		},
+	}
+
+	if r.Compile() == nil {
+		t.Error("Expected an error for an invalid match")
+	}
+
+	r = &Route{
+		RepeatInterval: "soon",
+	}
+
+	if r.Compile() == nil {
+		t.Error("Expected an error for an invalid repeat interval")
+	}
+}
@@ -0,0 +1,351 @@
+package slack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/eliothedeman/bangarang/escalation"
+	"github.com/eliothedeman/bangarang/event"
+)
+
+const (
+	DEFAULT_API_URL  = "https://slack.com/api"
+	DEFAULT_USERNAME = "bangarang"
+	DEFAULT_TIMEOUT  = "10s"
+
+	// the most of a failed response body that will be included in an error
+	MAX_ERROR_BODY = 512
+)
+
+var (
+	// the attachment color used for each status
+	statusColors = map[int]string{
+		event.OK:       "good",
+		event.WARNING:  "warning",
+		event.CRITICAL: "danger",
+	}
+)
+
+func init() {
+	escalation.LoadFactory("slack", NewSlack)
+}
+
+// Slack posts incidents to a slack channel. When a token is given, the chat api is used
+// so follow up messages for an incident are threaded under the first one.
+type Slack struct {
+	conf   *SlackConfig
+	client *http.Client
+
+	// maps an incident's index name to the message which started its thread
+	threads map[string]*thread
+	sync.Mutex
+}
+
+// a message that has been posted through the chat api. The thread is added before its first
+// message is posted, and ready is closed once it has been, so concurrent sends wait for it
+type thread struct {
+	Channel string
+	Ts      string
+	ready   chan struct{}
+}
+
+// SlackConfig holds the options for the slack escalation
+type SlackConfig struct {
+	WebhookURL string `json:"webhook_url" schema:"secret"`
+	Token      string `json:"token" schema:"secret"`
+	Channel    string `json:"channel"`
+	APIURL     string `json:"api_url"`
+	Username   string `json:"username"`
+	IconEmoji  string `json:"icon_emoji"`
+	UIURL      string `json:"ui_url"`
+	Timeout    string `json:"timeout"`
+}
+
+// Message is a slack chat message
+type Message struct {
+	Channel     string        `json:"channel,omitempty"`
+	Ts          string        `json:"ts,omitempty"`
+	ThreadTs    string        `json:"thread_ts,omitempty"`
+	Username    string        `json:"username,omitempty"`
+	IconEmoji   string        `json:"icon_emoji,omitempty"`
+	Text        string        `json:"text,omitempty"`
+	Attachments []*Attachment `json:"attachments,omitempty"`
+}
+
+// Attachment is the rich formatting of an incident within a message
+type Attachment struct {
+	Fallback  string   `json:"fallback"`
+	Color     string   `json:"color"`
+	Title     string   `json:"title"`
+	TitleLink string   `json:"title_link,omitempty"`
+	Text      string   `json:"text"`
+	Fields    []*Field `json:"fields"`
+	Ts        int64    `json:"ts"`
+}
+
+// Field is a single key/value displayed in an attachment
+type Field struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+// the response from the slack chat api
+type apiResponse struct {
+	Ok      bool   `json:"ok"`
+	Error   string `json:"error"`
+	Channel string `json:"channel"`
+	Ts      string `json:"ts"`
+}
+
+func NewSlack() escalation.Escalation {
+	return &Slack{
+		threads: make(map[string]*thread),
+	}
+}
+
+func (s *Slack) ConfigStruct() interface{} {
+	return &SlackConfig{
+		APIURL:   DEFAULT_API_URL,
+		Username: DEFAULT_USERNAME,
+		Timeout:  DEFAULT_TIMEOUT,
+	}
+}
+
+func (s *Slack) Init(i interface{}) error {
+	logrus.Info("Initializing slack escalation")
+	c, ok := i.(*SlackConfig)
+	if !ok {
+		return fmt.Errorf("Incorrect config type. Expecting SlackConfig not %+v", i)
+	}
+
+	if c.WebhookURL == "" && c.Token == "" {
+		return fmt.Errorf("Either a webhook_url or a token must be provided for slack")
+	}
+
+	if c.Token != "" && c.Channel == "" {
+		return fmt.Errorf("A channel must be provided when using a slack token")
+	}
+
+	timeout, err := time.ParseDuration(c.Timeout)
+	if err != nil {
+		return err
+	}
+
+	s.conf = c
+	s.client = &http.Client{
+		Timeout: timeout,
+	}
+
+	return nil
+}
+
+// formatAttachment creates the rich formatting for an incident
+func (s *Slack) formatAttachment(i *event.Incident) *Attachment {
+	desc := i.Description
+	if desc == "" {
+		desc = i.FormatDescription()
+	}
+
+	a := &Attachment{
+		Fallback:  fmt.Sprintf("[%s] %s", event.Status(i.Status), desc),
+		Color:     statusColors[i.Status],
+		Title:     fmt.Sprintf("[%s] %s", event.Status(i.Status), i.Policy),
+		TitleLink: s.conf.UIURL,
+		Text:      desc,
+		Ts:        i.Time,
+		Fields: []*Field{
+			{
+				Title: "metric",
+				Value: fmt.Sprint(i.Metric),
+				Short: true,
+			},
+		},
+	}
+
+	i.Tags.ForEach(func(k, v string) {
+		a.Fields = append(a.Fields, &Field{
+			Title: k,
+			Value: v,
+			Short: true,
+		})
+	})
+
+	// sorted so the message looks the same every time
+	keys := make([]string, 0, len(i.Annotations))
+	for k := range i.Annotations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		a.Fields = append(a.Fields, &Field{
+			Title: k,
+			Value: i.Annotations[k],
+		})
+	}
+
+	return a
+}
+
+// newMessage creates a message for the incident
+func (s *Slack) newMessage(i *event.Incident) *Message {
+	return &Message{
+		Channel:     s.conf.Channel,
+		Username:    s.conf.Username,
+		IconEmoji:   s.conf.IconEmoji,
+		Attachments: []*Attachment{s.formatAttachment(i)},
+	}
+}
+
+// Send the incident to slack
+func (s *Slack) Send(i *event.Incident) error {
+	m := s.newMessage(i)
+
+	// incoming webhooks have no way to reference an earlier message
+	if s.conf.Token == "" {
+		return s.post(s.conf.WebhookURL, m, nil)
+	}
+
+	return s.sendThreaded(i, m)
+}
+
+// thread returns the incident's thread, waiting for its first message if it is still being posted.
+// If there is no thread, a new one is added and started is true; the caller must then post the
+// first message and call startThread
+func (s *Slack) thread(name string) (t *thread, started bool) {
+	for {
+		s.Lock()
+		t, ok := s.threads[name]
+		if !ok {
+			t = &thread{
+				ready: make(chan struct{}),
+			}
+			s.threads[name] = t
+			s.Unlock()
+			return t, true
+		}
+		s.Unlock()
+
+		// a thread whose first message couldn't be posted has been removed, so look again
+		<-t.ready
+		if t.Ts != "" {
+			return t, false
+		}
+	}
+}
+
+// startThread records the first message of the thread, or removes the thread if resp is nil
+func (s *Slack) startThread(name string, t *thread, resp *apiResponse) {
+	s.Lock()
+	if resp != nil {
+		t.Channel = resp.Channel
+		t.Ts = resp.Ts
+	} else {
+		delete(s.threads, name)
+	}
+	s.Unlock()
+
+	close(t.ready)
+}
+
+// sendThreaded posts the first message for an incident, and threads every update under it
+func (s *Slack) sendThreaded(i *event.Incident, m *Message) error {
+	name := string(i.IndexName())
+	t, started := s.thread(name)
+
+	// start a new thread
+	if started {
+		resp := &apiResponse{}
+		err := s.post(s.conf.APIURL+"/chat.postMessage", m, resp)
+		if err != nil {
+			s.startThread(name, t, nil)
+			return err
+		}
+
+		// a resolution with nothing to resolve doesn't need a thread
+		if i.Status == event.OK {
+			resp = nil
+		}
+		s.startThread(name, t, resp)
+
+		return nil
+	}
+
+	// reply in the thread
+	m.ThreadTs = t.Ts
+	err := s.post(s.conf.APIURL+"/chat.postMessage", m, &apiResponse{})
+	if err != nil {
+		return err
+	}
+
+	// update the first message so the channel shows the current status
+	update := s.newMessage(i)
+	update.Channel = t.Channel
+	update.Ts = t.Ts
+	err = s.post(s.conf.APIURL+"/chat.update", update, &apiResponse{})
+	if err != nil {
+		return err
+	}
+
+	// once resolved, the thread is complete
+	if i.Status == event.OK {
+		s.Lock()
+		delete(s.threads, name)
+		s.Unlock()
+	}
+
+	return nil
+}
+
+// post the message to the given url. If resp is not nil, the body is decoded as a chat api response
+func (s *Slack) post(url string, m *Message, resp *apiResponse) error {
+	buff, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(buff))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if s.conf.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.conf.Token)
+	}
+
+	r, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(&io.LimitedReader{R: r.Body, N: MAX_ERROR_BODY})
+		return fmt.Errorf("Slack returned %s: %s", r.Status, string(body))
+	}
+
+	if resp == nil {
+		return nil
+	}
+
+	err = json.NewDecoder(r.Body).Decode(resp)
+	if err != nil {
+		return err
+	}
+
+	if !resp.Ok {
+		return fmt.Errorf("Slack api error: %s", resp.Error)
+	}
+
+	return nil
+}
@@ -0,0 +1,199 @@
+package slack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/eliothedeman/bangarang/event"
+)
+
+type recorded struct {
+	path string
+	auth string
+	msg  *Message
+}
+
+// a stand in for slack that records every message it is sent
+type testSlack struct {
+	*httptest.Server
+	recorded []*recorded
+	sync.Mutex
+}
+
+func newTestSlack() *testSlack {
+	t := &testSlack{}
+	t.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := &Message{}
+		json.NewDecoder(r.Body).Decode(m)
+
+		t.Lock()
+		t.recorded = append(t.recorded, &recorded{
+			path: r.URL.Path,
+			auth: r.Header.Get("Authorization"),
+			msg:  m,
+		})
+		n := len(t.recorded)
+		t.Unlock()
+
+		fmt.Fprintf(w, `{"ok": true, "channel": "C1", "ts": "%d.000"}`, n)
+	}))
+
+	return t
+}
+
+func (t *testSlack) get(i int) *recorded {
+	t.Lock()
+	defer t.Unlock()
+	return t.recorded[i]
+}
+
+func newTestEscalation(t *testing.T, conf *SlackConfig) *Slack {
+	s := NewSlack().(*Slack)
+	c := s.ConfigStruct().(*SlackConfig)
+	c.WebhookURL = conf.WebhookURL
+	c.Token = conf.Token
+	c.Channel = conf.Channel
+	c.UIURL = "http://bangarang.test"
+	if conf.APIURL != "" {
+		c.APIURL = conf.APIURL
+	}
+
+	err := s.Init(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func newTestIncident(status int) *event.Incident {
+	e := event.NewEvent()
+	e.Tags.Set("host", "test.com")
+	e.Tags.Set("service", "cpu")
+	e.Metric = 95
+	return event.NewIncident("cpu_high", status, e)
+}
+
+func TestWebhook(t *testing.T) {
+	ts := newTestSlack()
+	defer ts.Close()
+
+	s := newTestEscalation(t, &SlackConfig{WebhookURL: ts.URL + "/hook"})
+	err := s.Send(newTestIncident(event.CRITICAL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := ts.get(0)
+	if r.path != "/hook" {
+		t.Error(r.path)
+	}
+
+	a := r.msg.Attachments[0]
+	if a.Color != "danger" {
+		t.Error(a.Color)
+	}
+
+	if a.TitleLink != "http://bangarang.test" {
+		t.Error(a.TitleLink)
+	}
+
+	// metric, host, service
+	if len(a.Fields) != 3 || a.Fields[0].Value != "95" || a.Fields[1].Value != "test.com" {
+		t.Error(a.Fields)
+	}
+}
+
+func TestThreadedResolve(t *testing.T) {
+	ts := newTestSlack()
+	defer ts.Close()
+
+	s := newTestEscalation(t, &SlackConfig{
+		Token:   "xoxb-test",
+		Channel: "#alerts",
+		APIURL:  ts.URL,
+	})
+
+	err := s.Send(newTestIncident(event.CRITICAL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Send(newTestIncident(event.OK))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := ts.get(0)
+	if first.path != "/chat.postMessage" || first.auth != "Bearer xoxb-test" {
+		t.Error(first.path, first.auth)
+	}
+
+	// the resolution is posted in the thread of the first message
+	reply := ts.get(1)
+	if reply.msg.ThreadTs != "1.000" {
+		t.Error(reply.msg.ThreadTs)
+	}
+
+	if reply.msg.Attachments[0].Color != "good" {
+		t.Error(reply.msg.Attachments[0].Color)
+	}
+
+	// and the first message is updated
+	update := ts.get(2)
+	if update.path != "/chat.update" || update.msg.Ts != "1.000" || update.msg.Channel != "C1" {
+		t.Error(update.path, update.msg)
+	}
+
+	// a resolved incident should start a new thread next time
+	if len(s.threads) != 0 {
+		t.Error(s.threads)
+	}
+}
+
+func TestInitRequiresDestination(t *testing.T) {
+	s := NewSlack()
+	if s.Init(s.ConfigStruct()) == nil {
+		t.Fatal("Expected an error without a webhook_url or token")
+	}
+}
+
+func TestConcurrentThread(t *testing.T) {
+	ts := newTestSlack()
+	defer ts.Close()
+
+	s := newTestEscalation(t, &SlackConfig{
+		Token:   "xoxb-test",
+		Channel: "#alerts",
+		APIURL:  ts.URL,
+	})
+
+	var wg sync.WaitGroup
+	for x := 0; x < 5; x++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.Send(newTestIncident(event.CRITICAL))
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// one message starts the thread, and every other send replies in it
+	started := 0
+	for x := range ts.recorded {
+		r := ts.get(x)
+		if r.path == "/chat.postMessage" && r.msg.ThreadTs == "" {
+			started++
+		}
+	}
+
+	if started != 1 {
+		t.Error("Expected a single thread, got", started)
+	}
+}
@@ -0,0 +1,34 @@
+package escalation
+
+import (
+	"encoding/json"
+	html_template "html/template"
+	"text/template"
+
+	"github.com/eliothedeman/bangarang/event"
+)
+
+var (
+	// TemplateFuncs are made available to every template rendered from an incident
+	TemplateFuncs = template.FuncMap{
+		"status": event.Status,
+		"json":   toJSON,
+	}
+)
+
+// toJSON encodes the value as json so it can be embedded in a json payload
+func toJSON(i interface{}) (string, error) {
+	buff, err := json.Marshal(i)
+	return string(buff), err
+}
+
+// NewTemplate parses the text into a template which has access to the TemplateFuncs
+func NewTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(TemplateFuncs).Parse(text)
+}
+
+// NewHTMLTemplate parses the text into an html template which has access to the TemplateFuncs.
+// Values from the incident are escaped, so tags can't inject markup
+func NewHTMLTemplate(name, text string) (*html_template.Template, error) {
+	return html_template.New(name).Funcs(html_template.FuncMap(TemplateFuncs)).Parse(text)
+}
@@ -0,0 +1,178 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/eliothedeman/bangarang/escalation"
+	"github.com/eliothedeman/bangarang/event"
+)
+
+const (
+	DEFAULT_METHOD       = "POST"
+	DEFAULT_TIMEOUT      = "10s"
+	DEFAULT_CONTENT_TYPE = "application/json"
+
+	// the most of a failed response body that will be included in an error
+	MAX_ERROR_BODY = 512
+)
+
+func init() {
+	escalation.LoadFactory("webhook", NewWebhook)
+}
+
+// Webhook sends incidents to an arbitrary http endpoint
+type Webhook struct {
+	conf   *WebhookConfig
+	body   *template.Template
+	client *http.Client
+}
+
+// WebhookConfig holds the options for a Webhook
+type WebhookConfig struct {
+	URL                string            `json:"url" schema:"required"`
+	Method             string            `json:"method"`
+	Headers            map[string]string `json:"headers" schema:"secret"`
+	Timeout            string            `json:"timeout"`
+	Body               string            `json:"body"`
+	InsecureSkipVerify bool              `json:"insecure_skip_verify"`
+	CAFile             string            `json:"ca_file"`
+	CertFile           string            `json:"cert_file"`
+	KeyFile            string            `json:"key_file"`
+}
+
+func NewWebhook() escalation.Escalation {
+	return &Webhook{}
+}
+
+func (w *Webhook) ConfigStruct() interface{} {
+	return &WebhookConfig{
+		Method:  DEFAULT_METHOD,
+		Timeout: DEFAULT_TIMEOUT,
+	}
+}
+
+func (w *Webhook) Init(i interface{}) error {
+	logrus.Info("Initializing webhook escalation")
+	c, ok := i.(*WebhookConfig)
+	if !ok {
+		return fmt.Errorf("Incorrect config type. Expecting WebhookConfig not %+v", i)
+	}
+
+	if c.URL == "" {
+		return fmt.Errorf("A url must be provided for a webhook")
+	}
+
+	timeout, err := time.ParseDuration(c.Timeout)
+	if err != nil {
+		return err
+	}
+
+	// an empty body means the incident will be sent as json
+	if c.Body != "" {
+		w.body, err = escalation.NewTemplate("body", c.Body)
+		if err != nil {
+			return err
+		}
+	}
+
+	tlsConf, err := loadTLSConfig(c)
+	if err != nil {
+		return err
+	}
+
+	w.conf = c
+	w.client = &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConf,
+		},
+	}
+
+	return nil
+}
+
+// loadTLSConfig creates the tls options for the webhook's client
+func loadTLSConfig(c *WebhookConfig) (*tls.Config, error) {
+	conf := &tls.Config{
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	// trust the given certificate authority
+	if c.CAFile != "" {
+		buff, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(buff) {
+			return nil, fmt.Errorf("No certificates found in %s", c.CAFile)
+		}
+	}
+
+	// present a client certificate
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	return conf, nil
+}
+
+// render creates the body of the request for the given incident
+func (w *Webhook) render(i *event.Incident) ([]byte, error) {
+	if w.body == nil {
+		return json.Marshal(i)
+	}
+
+	buff := bytes.NewBuffer(nil)
+	err := w.body.Execute(buff, i)
+	return buff.Bytes(), err
+}
+
+// Send the incident to the configured url
+func (w *Webhook) Send(i *event.Incident) error {
+	body, err := w.render(i)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(w.conf.Method, w.conf.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", DEFAULT_CONTENT_TYPE)
+	for k, v := range w.conf.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// anything outside of the 2xx range is a failed delivery
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		buff, _ := ioutil.ReadAll(&io.LimitedReader{R: resp.Body, N: MAX_ERROR_BODY})
+		return fmt.Errorf("Webhook %s returned %s: %s", w.conf.URL, resp.Status, string(buff))
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eliothedeman/bangarang/event"
+)
+
+type request struct {
+	method string
+	header http.Header
+	body   []byte
+}
+
+func newTestServer(code int) (*httptest.Server, chan *request) {
+	reqs := make(chan *request, 10)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buff, _ := ioutil.ReadAll(r.Body)
+		reqs <- &request{
+			method: r.Method,
+			header: r.Header,
+			body:   buff,
+		}
+		w.WriteHeader(code)
+	}))
+
+	return s, reqs
+}
+
+func newTestWebhook(t *testing.T, raw string) *Webhook {
+	w := NewWebhook().(*Webhook)
+	conf := w.ConfigStruct()
+	err := json.Unmarshal([]byte(raw), conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = w.Init(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return w
+}
+
+func newTestIncident() *event.Incident {
+	e := event.NewEvent()
+	e.Tags.Set("host", "test.com")
+	e.Tags.Set("service", "cpu")
+	e.Metric = 95.5
+	return event.NewIncident("cpu_high", event.CRITICAL, e)
+}
+
+func TestSendDefaultBody(t *testing.T) {
+	s, reqs := newTestServer(http.StatusOK)
+	defer s.Close()
+
+	w := newTestWebhook(t, `{"url": "`+s.URL+`"}`)
+	err := w.Send(newTestIncident())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := <-reqs
+	if r.method != "POST" {
+		t.Error(r.method)
+	}
+
+	in := &event.Incident{}
+	err = json.Unmarshal(r.body, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if in.Policy != "cpu_high" || in.Tags.Get("host") != "test.com" {
+		t.Error(string(r.body))
+	}
+}
+
+func TestSendTemplate(t *testing.T) {
+	s, reqs := newTestServer(http.StatusOK)
+	defer s.Close()
+
+	w := newTestWebhook(t, `{
+		"url": "`+s.URL+`",
+		"method": "PUT",
+		"headers": {"X-Token": "secret"},
+		"body": "{{.Tags.Get \"host\"}} {{status .Status}} {{.Metric}} {{.Policy}}"
+	}`)
+
+	err := w.Send(newTestIncident())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := <-reqs
+	if r.method != "PUT" {
+		t.Error(r.method)
+	}
+
+	if r.header.Get("X-Token") != "secret" {
+		t.Error(r.header)
+	}
+
+	if string(r.body) != "test.com critical 95.5 cpu_high" {
+		t.Error(string(r.body))
+	}
+}
+
+func TestSendErrorStatus(t *testing.T) {
+	s, _ := newTestServer(http.StatusInternalServerError)
+	defer s.Close()
+
+	w := newTestWebhook(t, `{"url": "`+s.URL+`"}`)
+	if w.Send(newTestIncident()) == nil {
+		t.Fatal("Expected an error for a non 2xx response")
+	}
+}
+
+func TestInitBadTemplate(t *testing.T) {
+	w := NewWebhook()
+	conf := w.ConfigStruct().(*WebhookConfig)
+	conf.URL = "http://localhost"
+	conf.Body = "{{.Tags"
+	if w.Init(conf) == nil {
+		t.Fatal("Expected an error for an invalid template")
+	}
+}
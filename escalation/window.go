@@ -0,0 +1,210 @@
+package escalation
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/eliothedeman/bangarang/event"
+)
+
+const (
+	MINUTES_PER_DAY = 24 * 60
+	DATE_FORMAT     = "2006-01-02"
+)
+
+var (
+	weekdays = map[string]time.Weekday{
+		"sun": time.Sunday,
+		"mon": time.Monday,
+		"tue": time.Tuesday,
+		"wed": time.Wednesday,
+		"thu": time.Thursday,
+		"fri": time.Friday,
+		"sat": time.Saturday,
+	}
+)
+
+// TimeWindow is a recurring period of time an escalation policy is active in. A window whose
+// end is before its start runs past midnight into the next day
+type TimeWindow struct {
+	// days of the week the window starts on, "mon" or "monday". Every day if empty
+	Weekdays []string `json:"weekdays"`
+
+	// time of day as "15:04". The whole day if empty
+	Start string `json:"start"`
+	End   string `json:"end"`
+
+	// the name of the time zone, "America/New_York". The local time zone if empty
+	TimeZone string `json:"time_zone"`
+
+	// dates as "2006-01-02" the window is not active on
+	Holidays []string `json:"holidays"`
+
+	days     map[time.Weekday]bool
+	start    int
+	end      int
+	loc      *time.Location
+	holidays map[string]bool
+}
+
+// parseTimeOfDay parses "15:04" into minutes since midnight
+func parseTimeOfDay(s string) (int, error) {
+	var h, m int
+	_, err := fmt.Sscanf(s, "%d:%d", &h, &m)
+	if err != nil || h < 0 || m < 0 || m > 59 || h*60+m > MINUTES_PER_DAY {
+		return 0, fmt.Errorf("Invalid time of day %s. Expecting hh:mm", s)
+	}
+
+	return h*60 + m, nil
+}
+
+// Compile parses the days, times, and time zone of the window
+func (w *TimeWindow) Compile() (err error) {
+	w.days = make(map[time.Weekday]bool, len(w.Weekdays))
+	for _, d := range w.Weekdays {
+		name := strings.ToLower(d)
+		if len(name) > 3 {
+			name = name[:3]
+		}
+
+		day, ok := weekdays[name]
+		if !ok {
+			return fmt.Errorf("Unknown weekday %s", d)
+		}
+
+		w.days[day] = true
+	}
+
+	w.start, w.end = 0, MINUTES_PER_DAY
+	if w.Start != "" {
+		w.start, err = parseTimeOfDay(w.Start)
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.End != "" {
+		w.end, err = parseTimeOfDay(w.End)
+		if err != nil {
+			return err
+		}
+	}
+
+	w.loc = time.Local
+	if w.TimeZone != "" {
+		w.loc, err = time.LoadLocation(w.TimeZone)
+		if err != nil {
+			return err
+		}
+	}
+
+	w.holidays = make(map[string]bool, len(w.Holidays))
+	for _, h := range w.Holidays {
+		_, err = time.Parse(DATE_FORMAT, h)
+		if err != nil {
+			return fmt.Errorf("Invalid holiday %s. Expecting yyyy-mm-dd", h)
+		}
+
+		w.holidays[h] = true
+	}
+
+	return nil
+}
+
+// onDay returns true if the window starts on the given weekday
+func (w *TimeWindow) onDay(d time.Weekday) bool {
+	return len(w.days) == 0 || w.days[d]
+}
+
+// Contains returns true if the window is active at the given time
+func (w *TimeWindow) Contains(t time.Time) bool {
+	t = t.In(w.loc)
+	if w.holidays[t.Format(DATE_FORMAT)] {
+		return false
+	}
+
+	now := t.Hour()*60 + t.Minute()
+	if w.start <= w.end {
+		return w.onDay(t.Weekday()) && now >= w.start && now < w.end
+	}
+
+	// the window runs past midnight, so the early hours belong to the window that started yesterday
+	if now >= w.start {
+		return w.onDay(t.Weekday())
+	}
+
+	return now < w.end && w.onDay(t.AddDate(0, 0, -1).Weekday())
+}
+
+// compileWindows compiles every active time window of the policy
+func (e *EscalationPolicy) compileWindows() error {
+	for _, w := range e.ActiveTimes {
+		err := w.Compile()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Active returns true if the policy is in one of its active time windows. A policy with no windows is always active
+func (e *EscalationPolicy) Active(t time.Time) bool {
+	if len(e.ActiveTimes) == 0 {
+		return true
+	}
+
+	for _, w := range e.ActiveTimes {
+		if w.Contains(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// enqueue holds the incident until the policy's next active window. Any held update of the same
+// incident has already been released by Deliver
+func (e *EscalationPolicy) enqueue(i *event.Incident) {
+	e.queueLock.Lock()
+	defer e.queueLock.Unlock()
+
+	e.queue = append(e.queue, i)
+}
+
+// release drops any held update of the incident, because a newer one has arrived. Returns true
+// if the incident resolved while an update was held, so nothing was ever sent for it
+func (e *EscalationPolicy) release(i *event.Incident) bool {
+	e.queueLock.Lock()
+	defer e.queueLock.Unlock()
+
+	name := string(i.IndexName())
+	for x, q := range e.queue {
+		if string(q.IndexName()) == name {
+			e.queue = append(e.queue[:x], e.queue[x+1:]...)
+			return i.Status == event.OK && q.Status != event.OK
+		}
+	}
+
+	return false
+}
+
+// Flush sends every held incident if the policy is active at the given time, and returns a record of each attempt
+func (e *EscalationPolicy) Flush(t time.Time) []*event.Delivery {
+	if !e.Active(t) {
+		return nil
+	}
+
+	e.queueLock.Lock()
+	queue := e.queue
+	e.queue = nil
+	e.queueLock.Unlock()
+
+	var deliveries []*event.Delivery
+	for _, i := range queue {
+		deliveries = append(deliveries, e.send(i)...)
+	}
+
+	return deliveries
+}
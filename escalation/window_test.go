@@ -0,0 +1,170 @@
+package escalation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eliothedeman/bangarang/event"
+)
+
+// countingEscalation counts the incidents it is sent
+type countingEscalation struct {
+	sent []*event.Incident
+}
+
+func (c *countingEscalation) Send(i *event.Incident) error {
+	c.sent = append(c.sent, i)
+	return nil
+}
+
+func (c *countingEscalation) ConfigStruct() interface{} {
+	return nil
+}
+
+func (c *countingEscalation) Init(interface{}) error {
+	return nil
+}
+
+func testTime(s string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestWindowContains(t *testing.T) {
+	business := &TimeWindow{
+		Weekdays: []string{"mon", "Tuesday", "wed", "thu", "fri"},
+		Start:    "09:00",
+		End:      "17:00",
+		TimeZone: "UTC",
+		Holidays: []string{"2015-12-25"},
+	}
+
+	night := &TimeWindow{
+		Weekdays: []string{"fri"},
+		Start:    "22:00",
+		End:      "06:00",
+		TimeZone: "UTC",
+	}
+
+	for _, w := range []*TimeWindow{business, night} {
+		err := w.Compile()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		w        *TimeWindow
+		t        string
+		expected bool
+	}{
+		{business, "2015-12-22 10:00", true},
+		{business, "2015-12-22 08:59", false},
+		{business, "2015-12-22 17:00", false},
+		{business, "2015-12-25 10:00", false},
+		{business, "2015-12-26 10:00", false},
+		{night, "2015-12-25 23:00", true},
+		{night, "2015-12-26 05:59", true},
+		{night, "2015-12-26 23:00", false},
+		{night, "2015-12-25 05:00", false},
+	}
+
+	for _, test := range tests {
+		if test.w.Contains(testTime(test.t)) != test.expected {
+			t.Errorf("%s: expected %t", test.t, test.expected)
+		}
+	}
+}
+
+func TestWindowCompileError(t *testing.T) {
+	for _, w := range []*TimeWindow{
+		{Weekdays: []string{"someday"}},
+		{Start: "9am"},
+		{End: "25:00"},
+		{TimeZone: "Nowhere/Special"},
+		{Holidays: []string{"christmas"}},
+	} {
+		if w.Compile() == nil {
+			t.Errorf("Expected an error for %+v", w)
+		}
+	}
+}
+
+func TestQueueOutsideWindows(t *testing.T) {
+	c := &countingEscalation{}
+	e := &EscalationPolicy{
+		Crit:                true,
+		Ok:                  true,
+		QueueOutsideWindows: true,
+		Escalations:         []Escalation{c},
+
+		// a window that is open every day but today
+		ActiveTimes: []*TimeWindow{
+			{
+				Holidays: []string{time.Now().Format(DATE_FORMAT)},
+			},
+		},
+	}
+
+	err := e.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newIncident := func(host string, status int) *event.Incident {
+		ev := event.NewEvent()
+		ev.Tags.Set("host", host)
+		return event.NewIncident("test", status, ev)
+	}
+
+	e.Deliver(newIncident("a", event.CRITICAL))
+	e.Deliver(newIncident("b", event.CRITICAL))
+
+	// resolved before anyone was told about it
+	e.Deliver(newIncident("b", event.OK))
+
+	if len(c.sent) != 0 {
+		t.Fatal(c.sent)
+	}
+
+	if len(e.Flush(time.Now())) != 0 {
+		t.Error("Nothing should be sent outside of the window")
+	}
+
+	ds := e.Flush(time.Now().AddDate(0, 0, 2))
+	if len(ds) != 1 || len(c.sent) != 1 || c.sent[0].Tags.Get("host") != "a" {
+		t.Error(ds, c.sent)
+	}
+}
+
+func TestQueueResolvedWithoutOk(t *testing.T) {
+	c := &countingEscalation{}
+	e := &EscalationPolicy{
+		Crit:                true,
+		QueueOutsideWindows: true,
+		Escalations:         []Escalation{c},
+		ActiveTimes: []*TimeWindow{
+			{
+				Holidays: []string{time.Now().Format(DATE_FORMAT)},
+			},
+		},
+	}
+
+	err := e.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e.Deliver(event.NewIncident("test", event.CRITICAL, event.NewEvent()))
+
+	// the policy doesn't send resolutions, but the held incident must still be dropped
+	e.Deliver(event.NewIncident("test", event.OK, event.NewEvent()))
+
+	ds := e.Flush(time.Now().AddDate(0, 0, 2))
+	if len(ds) != 0 || len(c.sent) != 0 {
+		t.Error("A resolved incident should not be sent", ds, c.sent)
+	}
+}
@@ -0,0 +1,244 @@
+package event
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/boltdb/bolt"
+)
+
+var (
+	DELIVERY_BUCKET_NAME = []byte("deliveries")
+
+	// the maximum number of deliveries that will be kept in the index before the oldest are dropped
+	MAX_DELIVERIES uint64 = 10000
+
+	// the number of deliveries that can wait to be written before PutDelivery blocks
+	MAX_PENDING_DELIVERIES = 1024
+)
+
+// A Delivery is a record of an attempt to send an incident to an escalation
+type Delivery struct {
+	Incident         string  `json:"incident"`
+	Policy           string  `json:"policy"`
+	Status           int     `json:"status"`
+	EscalationPolicy string  `json:"escalation_policy"`
+	Escalation       string  `json:"escalation"`
+	Type             string  `json:"type"`
+	Time             int64   `json:"time"`
+	Latency          float64 `json:"latency"`
+	Success          bool    `json:"success"`
+	Error            string  `json:"error,omitempty"`
+
+	// the escalation accepted the incident, but hasn't sent it yet
+	Queued bool `json:"queued,omitempty"`
+}
+
+// NewDelivery creates a delivery record for the given incident. The outcome is filled in by Done
+func NewDelivery(i *Incident, name, kind string) *Delivery {
+	return &Delivery{
+		Incident:   string(i.IndexName()),
+		Policy:     i.Policy,
+		Status:     i.Status,
+		Escalation: name,
+		Type:       kind,
+		Time:       time.Now().Unix(),
+	}
+}
+
+// Done records the outcome of the delivery that started at the given time
+func (d *Delivery) Done(start time.Time, err error) {
+	d.Latency = time.Since(start).Seconds()
+	d.Success = err == nil
+	if err != nil {
+		d.Error = err.Error()
+	}
+}
+
+// Queue records that the delivery that started at the given time was accepted to be sent later
+func (d *Delivery) Queue(start time.Time) {
+	d.Latency = time.Since(start).Seconds()
+	d.Queued = true
+}
+
+// encode the sequence number of a delivery as a sortable key
+func deliveryKey(seq uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, seq)
+	return k
+}
+
+// deliveryLog writes deliveries to the index in the background, so the incident path never waits on
+// the disk. Everything that is waiting when the writer gets to it is written in a single transaction
+type deliveryLog struct {
+	pending chan *Delivery
+	flushes chan chan struct{}
+	done    chan struct{}
+	closed  bool
+	sync.RWMutex
+}
+
+func newDeliveryLog() *deliveryLog {
+	return &deliveryLog{
+		pending: make(chan *Delivery, MAX_PENDING_DELIVERIES),
+		flushes: make(chan chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// PutDelivery appends the delivery to the log, dropping the oldest deliveries once the log is full.
+// The delivery is written in the background
+func (i *Index) PutDelivery(d *Delivery) {
+	i.deliveries.RLock()
+	defer i.deliveries.RUnlock()
+
+	if i.deliveries.closed {
+		logrus.Errorf("Unable to insert delivery into closed index")
+		return
+	}
+
+	i.deliveries.pending <- d
+}
+
+// flushDeliveries waits until every delivery put so far has been written
+func (i *Index) flushDeliveries() {
+	i.deliveries.RLock()
+	defer i.deliveries.RUnlock()
+
+	if i.deliveries.closed {
+		return
+	}
+
+	done := make(chan struct{})
+	i.deliveries.flushes <- done
+	<-done
+}
+
+// closeDeliveries writes the deliveries that are still waiting, and stops the writer
+func (i *Index) closeDeliveries() {
+	i.deliveries.Lock()
+	if !i.deliveries.closed {
+		i.deliveries.closed = true
+		close(i.deliveries.pending)
+	}
+	i.deliveries.Unlock()
+
+	<-i.deliveries.done
+}
+
+// writeDeliveries writes deliveries as they are put, until the log is closed
+func (i *Index) writeDeliveries() {
+	defer close(i.deliveries.done)
+
+	for {
+		select {
+		case d, ok := <-i.deliveries.pending:
+			if !ok {
+				return
+			}
+			i.putDeliveries(append([]*Delivery{d}, i.waitingDeliveries()...))
+
+		case done := <-i.deliveries.flushes:
+			i.putDeliveries(i.waitingDeliveries())
+			close(done)
+		}
+	}
+}
+
+// waitingDeliveries returns every delivery that has been put, but not written yet
+func (i *Index) waitingDeliveries() []*Delivery {
+	var ds []*Delivery
+	for {
+		select {
+		case d, ok := <-i.deliveries.pending:
+			if !ok {
+				return ds
+			}
+			ds = append(ds, d)
+		default:
+			return ds
+		}
+	}
+}
+
+// putDeliveries writes the deliveries in a single transaction
+func (i *Index) putDeliveries(ds []*Delivery) {
+	if len(ds) == 0 {
+		return
+	}
+
+	err := i.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(DELIVERY_BUCKET_NAME)
+
+		var seq uint64
+		for _, d := range ds {
+			buff, err := json.Marshal(d)
+			if err != nil {
+				return err
+			}
+
+			seq, err = b.NextSequence()
+			if err != nil {
+				return err
+			}
+
+			err = b.Put(deliveryKey(seq), buff)
+			if err != nil {
+				return err
+			}
+		}
+
+		// nothing needs to be dropped until the log is full
+		if seq <= MAX_DELIVERIES {
+			return nil
+		}
+
+		// trim everything older than the window
+		oldest := deliveryKey(seq - MAX_DELIVERIES)
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil && string(k) <= string(oldest); k, _ = c.First() {
+			err := c.Delete()
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		logrus.Errorf("Unable to insert %d deliveries into index %s", len(ds), err)
+	}
+}
+
+// ListDeliveries returns every delivery the filter accepts, newest first. A nil filter accepts all deliveries
+func (i *Index) ListDeliveries(filter func(d *Delivery) bool) []*Delivery {
+	i.flushDeliveries()
+
+	ds := []*Delivery{}
+	err := i.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(DELIVERY_BUCKET_NAME).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			d := &Delivery{}
+			err := json.Unmarshal(v, d)
+			if err != nil {
+				logrus.Warnf("Invalid json: key=%x val=%s", k, string(v))
+				continue
+			}
+
+			if filter == nil || filter(d) {
+				ds = append(ds, d)
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		logrus.Errorf("Unable to list deliveries %s", err)
+	}
+
+	return ds
+}
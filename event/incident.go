@@ -28,11 +28,21 @@ type Incident struct {
 	Description string `json:"description" msg:"description"`
 	Policy      string `json:"policy" msg:"policy"`
 	Status      int    `json:"status" "msg:"status"`
-	indexName   []byte
-	resChan     chan *Incident // this is used to call back to the policy that created this event
+
+	// where responders should go for this incident, as set by the policy that created it
+	Annotations map[string]string `json:"annotations,omitempty" msg:"annotations"`
+
+	indexName []byte
+	resChan   chan *Incident // this is used to call back to the policy that created this event
+	formatter IncidentFormatter
 	Event
 }
 
+// SetFormatter changes the formatter used to describe the incident
+func (i *Incident) SetFormatter(f IncidentFormatter) {
+	i.formatter = f
+}
+
 // SetResolve sets the incident resolver channel for the given incident
 func (i *Incident) SetResolve(r chan *Incident) {
 	i.resChan = r
@@ -61,6 +71,9 @@ func (i *Incident) GetEvent() *Event {
 
 // FormatDescription calls the formatter for this incident
 func (i *Incident) FormatDescription() string {
+	if i.formatter != nil {
+		return i.formatter(i)
+	}
 	return DefaultIncidentFormatter(i)
 }
 
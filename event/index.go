@@ -40,6 +40,7 @@ func (c *counter) get() int64 {
 type Index struct {
 	db              *bolt.DB
 	incidentCounter *counter
+	deliveries      *deliveryLog
 }
 
 func NewIndex() *Index {
@@ -50,21 +51,31 @@ func NewIndex() *Index {
 
 	err = db.Update(func(tx *bolt.Tx) error {
 		_, err := tx.CreateBucketIfNotExists(INCIDENT_BUCKET_NAME)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CreateBucketIfNotExists(DELIVERY_BUCKET_NAME)
 		return err
 	})
 	if err != nil {
-		logrus.Fatal("Unable to create incident bucket in the index db")
+		logrus.Fatal("Unable to create buckets in the index db")
 	}
 
-	return &Index{
+	i := &Index{
 		db:              db,
 		incidentCounter: &counter{},
+		deliveries:      newDeliveryLog(),
 	}
+
+	go i.writeDeliveries()
+	return i
 }
 
 // close out the index
 func (i *Index) Close() {
 	logrus.Info("Closing index")
+	i.closeDeliveries()
 	err := i.db.Close()
 	if err != nil {
 		logrus.Errorf("Unable to close index db: %s", err)
@@ -1,6 +1,7 @@
 package event
 
 import (
+	"fmt"
 	"log"
 	"testing"
 	"time"
@@ -81,3 +82,82 @@ func TestAddIncident(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestListDeliveries(t *testing.T) {
+	i := newTestIndex()
+	defer i.Delete()
+	a := NewIncident("a", CRITICAL, newTestEvent("h", "a", 1))
+	b := NewIncident("b", CRITICAL, newTestEvent("h", "b", 1))
+
+	i.PutDelivery(NewDelivery(a, "first", "test"))
+	i.PutDelivery(NewDelivery(b, "second", "test"))
+
+	all := i.ListDeliveries(nil)
+	if len(all) != 2 {
+		t.Fatal(all)
+	}
+
+	// newest first
+	if all[0].Escalation != "second" {
+		t.Fail()
+	}
+
+	ds := i.ListDeliveries(func(d *Delivery) bool {
+		return d.Incident == string(a.IndexName())
+	})
+	if len(ds) != 1 || ds[0].Escalation != "first" {
+		t.Fatal(ds)
+	}
+}
+
+func TestPutDeliveryBounded(t *testing.T) {
+	i := newTestIndex()
+	defer i.Delete()
+	max := MAX_DELIVERIES
+	MAX_DELIVERIES = 5
+	defer func() {
+		MAX_DELIVERIES = max
+	}()
+
+	in := NewIncident("test", CRITICAL, newTestEvent("h", "s", 1))
+	for x := 0; x < 8; x++ {
+		d := NewDelivery(in, fmt.Sprint(x), "test")
+		i.PutDelivery(d)
+	}
+
+	ds := i.ListDeliveries(nil)
+	if len(ds) != 5 {
+		t.Fatal(len(ds))
+	}
+
+	// the oldest deliveries should have been dropped
+	if ds[4].Escalation != "3" {
+		t.Fatal(ds[4].Escalation)
+	}
+}
+
+func TestPutDeliveryClose(t *testing.T) {
+	i := newTestIndex()
+	in := NewIncident("test", CRITICAL, newTestEvent("h", "s", 1))
+	for x := 0; x < 100; x++ {
+		i.PutDelivery(NewDelivery(in, fmt.Sprint(x), "test"))
+	}
+
+	// every delivery waiting to be written is written before the index closes
+	i.Close()
+	i = NewIndex()
+	defer i.Delete()
+
+	ds := i.ListDeliveries(nil)
+	if len(ds) != 100 {
+		t.Fatal(len(ds))
+	}
+
+	if ds[0].Escalation != "99" || ds[99].Escalation != "0" {
+		t.Fatal(ds[0].Escalation, ds[99].Escalation)
+	}
+
+	// a closed index drops deliveries instead of blocking
+	i.Close()
+	i.PutDelivery(NewDelivery(in, "late", "test"))
+}
@@ -8,7 +8,6 @@ import (
 	"github.com/eliothedeman/bangarang/config"
 	"github.com/eliothedeman/bangarang/escalation"
 	"github.com/eliothedeman/bangarang/event"
-	"github.com/eliothedeman/bangarang/provider"
 )
 
 const (
@@ -17,6 +16,9 @@ const (
 
 var (
 	DefaultKeepAliveCheckTime = 1 * time.Minute
+
+	// how often incidents held by escalation policies outside of their active windows are checked
+	DefaultQueueCheckTime = 1 * time.Minute
 )
 
 // Pipeline
@@ -24,9 +26,10 @@ type Pipeline struct {
 	keepAliveAge       time.Duration
 	keepAliveCheckTime time.Duration
 	escalations        map[string]*escalation.EscalationPolicy
+	route              *escalation.Route
 	policies           map[string]*escalation.Policy
 	index              *event.Index
-	providers          provider.EventProviderCollection
+	providers          map[string]*runningProvider
 	config             *config.AppConfig
 	confLock           sync.Mutex
 	tracker            *Tracker
@@ -48,6 +51,7 @@ func NewPipeline() *Pipeline {
 		tracker:            NewTracker(),
 		keepAliveCheckTime: DefaultKeepAliveCheckTime,
 		escalations:        map[string]*escalation.EscalationPolicy{},
+		providers:          map[string]*runningProvider{},
 		index:              event.NewIndex(),
 	}
 
@@ -93,6 +97,42 @@ func (p *Pipeline) refreshPolicies(m map[string]*escalation.Policy) {
 	}
 }
 
+// refreshEscalations compiles the new escalation policies, keeping every escalation whose config
+// hasn't changed, and closes the escalations that are no longer used
+func (p *Pipeline) refreshEscalations(m map[string]*escalation.EscalationPolicy) {
+	escalations := make(map[string]*escalation.EscalationPolicy, len(m))
+	for name, v := range m {
+		old := p.escalations[name]
+
+		// policies that haven't been replaced are already running
+		if old == v {
+			escalations[name] = v
+			continue
+		}
+
+		// keep running the old policy if the new one is broken
+		err := v.CompileFrom(old)
+		if err != nil {
+			logrus.Errorf("Unable to compile escalation policy %s: %s", name, err)
+			if old != nil {
+				escalations[name] = old
+			}
+			continue
+		}
+
+		escalations[name] = v
+	}
+
+	for name, old := range p.escalations {
+		if escalations[name] != old {
+			logrus.Infof("Closing escalation policy %s", name)
+			old.Close()
+		}
+	}
+
+	p.escalations = escalations
+}
+
 // RemovePolicy will stop and remove the policy if it exists
 func (p *Pipeline) RemovePolicy(name string) {
 	p.Pause()
@@ -132,18 +172,10 @@ func (p *Pipeline) Refresh(conf *config.AppConfig) {
 	}
 
 	if conf.Escalations != nil {
-		p.escalations = conf.Escalations
-		// compile each escalation policiy
-
-		for _, v := range p.escalations {
-			v.Compile()
-		}
-
+		p.refreshEscalations(conf.Escalations)
 	}
 
-	if conf.EventProviders != nil {
-		p.providers = *conf.EventProviders
-	}
+	p.refreshRoute(conf.Route)
 
 	p.refreshPolicies(conf.Policies)
 
@@ -151,11 +183,9 @@ func (p *Pipeline) Refresh(conf *config.AppConfig) {
 	p.config = conf
 	p.Unpause()
 
-	// start up all of the providers
-	logrus.Infof("Starting %d providers", len(p.providers.Collection))
-	for name, ep := range p.providers.Collection {
-		logrus.Infof("Starting event provider %s", name)
-		go ep.Start(p)
+	// restart the providers that have changed
+	if conf.EventProviders != nil {
+		p.refreshProviders(conf.EventProviders)
 	}
 }
 
@@ -327,12 +357,17 @@ func (p *Pipeline) Start() {
 	// process all incidents
 	go func() {
 		var i *event.Incident
+		queueCheck := time.Tick(DefaultQueueCheckTime)
 
 		for {
 			select {
 			case i = <-p.incidentInput:
 				p.processIncident(i)
 
+			// send the held incidents of any escalation policy that has become active
+			case now := <-queueCheck:
+				p.flushEscalations(now)
+
 			case <-incidentPauseChan:
 
 				// wait for the unpause
@@ -364,15 +399,97 @@ func (p *Pipeline) processIncident(in *event.Incident) {
 			p.index.DeleteIncidentById(in.IndexName())
 		}
 
-		// send it on to every escalation
-		for _, esc := range p.escalations {
-			esc.PassIncident(in)
-		}
+		p.escalate(in)
 	}
 
 	in.GetEvent().SetState(event.StateComplete)
 }
 
+// escalate sends the incident to the escalations picked by the routing tree, or to every
+// escalation if there is no tree, and keeps a record of each delivery
+func (p *Pipeline) escalate(in *event.Incident) {
+	if p.route == nil {
+		for name := range p.escalations {
+			p.deliver(name, in)
+		}
+		return
+	}
+
+	now := time.Now()
+	for _, r := range p.route.Find(in.Tags) {
+		batch := r.Batch(in, now)
+		if len(batch) == 0 {
+			logrus.Debugf("Route %s is holding %s until its repeat interval", r.ID(), in.IndexName())
+		}
+
+		p.deliverBatch(r, batch)
+	}
+}
+
+// deliverBatch sends the incidents to every escalation policy of the route
+func (p *Pipeline) deliverBatch(r *escalation.Route, batch []*event.Incident) {
+	for _, i := range batch {
+		for _, name := range r.Targets() {
+			p.deliver(name, i)
+		}
+	}
+}
+
+// refreshRoute compiles the new routing tree. The groups of routes that are still in the tree are
+// kept, and whatever was held by routes that were removed is sent. Without a tree, incidents are
+// sent to every escalation. A tree that doesn't compile leaves the old one in place
+func (p *Pipeline) refreshRoute(r *escalation.Route) {
+	old := p.route
+	if r != nil {
+		err := r.CompileFrom(old)
+		if err != nil {
+			logrus.Errorf("Unable to compile escalation routes, keeping the old ones: %s", err)
+			return
+		}
+	}
+
+	p.route = r
+	if old != nil && old != r {
+		old.Drain(p.deliverBatch)
+	}
+}
+
+// deliver sends the incident to the named escalation policy
+func (p *Pipeline) deliver(name string, in *event.Incident) {
+	esc, ok := p.escalations[name]
+	if !ok {
+		logrus.Errorf("Unable to find escalation %s", name)
+		return
+	}
+
+	for _, d := range esc.Deliver(in) {
+		d.EscalationPolicy = name
+		p.index.PutDelivery(d)
+	}
+}
+
+// flushEscalations sends the incidents held by every route whose repeat interval has passed, and
+// by every escalation policy that is active at the given time
+func (p *Pipeline) flushEscalations(now time.Time) {
+	if p.route != nil {
+		p.route.Due(now, p.deliverBatch)
+	}
+
+	for name, esc := range p.escalations {
+		for _, d := range esc.Flush(now) {
+			d.EscalationPolicy = name
+			p.index.PutDelivery(d)
+		}
+	}
+}
+
+// GetRoute returns the routing tree incidents are escalated by, or nil if they are sent to every escalation
+func (p *Pipeline) GetRoute() *escalation.Route {
+	p.confLock.Lock()
+	defer p.confLock.Unlock()
+	return p.route
+}
+
 // Run the given event though the pipeline
 func (p *Pipeline) processEvent(e *event.Event) {
 
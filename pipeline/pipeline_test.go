@@ -1,6 +1,7 @@
 package pipeline
 
 import (
+	"errors"
 	"testing"
 	"time"
 
@@ -9,6 +10,7 @@ import (
 	"github.com/eliothedeman/bangarang/escalation"
 	"github.com/eliothedeman/bangarang/escalation/test"
 	"github.com/eliothedeman/bangarang/event"
+	"github.com/eliothedeman/bangarang/provider"
 )
 
 var (
@@ -390,3 +392,214 @@ func TestResolve(t *testing.T) {
 		}
 	})
 }
+
+func TestDeliveryLog(t *testing.T) {
+	x := runningTestContext()
+	x.runTest(func(p *Pipeline) {
+		u := &config.User{}
+		u.Permissions = config.WRITE
+
+		ta := test.NewTestAlert()
+
+		// add a escalation policy that will catch our metrics
+		p.UpdateConfig(func(c *config.AppConfig) error {
+			esc := &escalation.EscalationPolicy{}
+			esc.Crit = true
+			esc.Escalations = []escalation.Escalation{ta}
+			esc.Match = event.NewTagset(0)
+			esc.Match.Set("host", ".*")
+			c.Escalations["test"] = esc
+			esc.Compile()
+
+			return nil
+		}, u)
+
+		e := event.NewEvent()
+		e.Tags.Set("host", "test")
+		in := event.NewIncident("test", event.CRITICAL, e)
+		p.PassIncident(in)
+		in.WaitForState(event.StateComplete, 50*time.Millisecond)()
+
+		ds := p.GetIndex().ListDeliveries(nil)
+		if len(ds) != 1 {
+			t.Fatal(ds)
+		}
+
+		if ds[0].EscalationPolicy != "test" || !ds[0].Success {
+			t.Error(ds[0])
+		}
+
+		if ds[0].Incident != string(in.IndexName()) {
+			t.Error(ds[0])
+		}
+	})
+}
+
+func TestEscalationRoute(t *testing.T) {
+	x := runningTestContext()
+	x.runTest(func(p *Pipeline) {
+		u := &config.User{}
+		u.Permissions = config.WRITE
+
+		p.UpdateConfig(func(c *config.AppConfig) error {
+			for _, name := range []string{"db", "default"} {
+				esc := &escalation.EscalationPolicy{}
+				esc.Crit = true
+				esc.Escalations = []escalation.Escalation{test.NewTestAlert()}
+				esc.Compile()
+				c.Escalations[name] = esc
+			}
+
+			db := event.NewTagset(0)
+			db.Set("service", "db")
+			c.Route = &escalation.Route{
+				Escalations: []string{"default"},
+				Routes: []*escalation.Route{
+					{
+						Match:       db,
+						Escalations: []string{"db"},
+					},
+				},
+			}
+
+			return nil
+		}, u)
+
+		e := event.NewEvent()
+		e.Tags.Set("host", "test")
+		e.Tags.Set("service", "db")
+		in := event.NewIncident("test", event.CRITICAL, e)
+		p.PassIncident(in)
+		in.WaitForState(event.StateComplete, 50*time.Millisecond)()
+
+		ds := p.GetIndex().ListDeliveries(nil)
+		if len(ds) != 1 || ds[0].EscalationPolicy != "db" {
+			t.Fatal(ds)
+		}
+	})
+}
+
+func TestRefreshRouteInvalid(t *testing.T) {
+	x := runningTestContext()
+	x.runTest(func(p *Pipeline) {
+		r := &escalation.Route{
+			Escalations: []string{"default"},
+		}
+		p.refreshRoute(r)
+
+		// the root route can't match
+		db := event.NewTagset(0)
+		db.Set("service", "db")
+		p.refreshRoute(&escalation.Route{
+			Match:       db,
+			Escalations: []string{"db"},
+		})
+
+		if p.route != r {
+			t.Error("The old routes should be kept when the new ones don't compile", p.route)
+		}
+	})
+}
+
+// testProvider counts how many times it has been started and stopped
+type testProvider struct {
+	starts, stops int
+}
+
+func (t *testProvider) Start(event.EventPasser) error {
+	t.starts++
+	return nil
+}
+
+func (t *testProvider) Stop() error {
+	t.stops++
+	return nil
+}
+
+func (t *testProvider) ConfigStruct() interface{} {
+	return &struct{}{}
+}
+
+func (t *testProvider) Init(interface{}) error {
+	return nil
+}
+
+func TestRefreshProviders(t *testing.T) {
+	x := runningTestContext()
+	x.runTest(func(p *Pipeline) {
+		kept, changed := &testProvider{}, &testProvider{}
+		c := &provider.EventProviderCollection{
+			Collection: map[string]provider.EventProvider{},
+		}
+		c.Add("kept", kept, []byte(`{"type": "test", "listen": ":1"}`))
+		c.Add("changed", changed, []byte(`{"type": "test", "listen": ":2"}`))
+		p.refreshProviders(c)
+
+		// the same configs, formatted differently, and a changed one
+		replaced := &testProvider{}
+		c = &provider.EventProviderCollection{
+			Collection: map[string]provider.EventProvider{},
+		}
+		c.Add("kept", &testProvider{}, []byte(`{"listen":":1","type":"test"}`))
+		c.Add("changed", replaced, []byte(`{"type": "test", "listen": ":3"}`))
+		p.refreshProviders(c)
+
+		if kept.starts != 1 || kept.stops != 0 {
+			t.Error("An unchanged provider should keep running", kept)
+		}
+
+		if changed.stops != 1 || replaced.starts != 1 {
+			t.Error("A changed provider should be restarted", changed, replaced)
+		}
+
+		// removed
+		p.refreshProviders(&provider.EventProviderCollection{})
+		if kept.stops != 1 || replaced.stops != 1 {
+			t.Error("Removed providers should be stopped", kept, replaced)
+		}
+
+		if len(p.ProviderStatus()) != 0 {
+			t.Error(p.ProviderStatus())
+		}
+	})
+}
+
+// failingProvider fails right after it is started
+type failingProvider struct {
+	testProvider
+	provider.Failure
+}
+
+func (f *failingProvider) Start(p event.EventPasser) error {
+	f.testProvider.Start(p)
+	f.Fail(f.Begin(), errors.New("listener died"))
+	return nil
+}
+
+func (f *failingProvider) Stop() error {
+	f.End()
+	return f.testProvider.Stop()
+}
+
+func TestProviderFailure(t *testing.T) {
+	x := runningTestContext()
+	x.runTest(func(p *Pipeline) {
+		f := &failingProvider{}
+		c := &provider.EventProviderCollection{
+			Collection: map[string]provider.EventProvider{},
+		}
+		c.Add("failing", f, []byte(`{"type": "test"}`))
+		p.refreshProviders(c)
+
+		s := p.ProviderStatus()["failing"]
+		if s.Running || s.Error != "listener died" {
+			t.Error("A provider that failed after starting should not be running", s)
+		}
+
+		// the failed provider is stopped and started again on the next refresh
+		p.refreshProviders(c)
+		if f.stops != 1 || f.starts != 2 {
+			t.Error(f.starts, f.stops)
+		}
+	})
+}
@@ -0,0 +1,113 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/eliothedeman/bangarang/provider"
+)
+
+// runningProvider is an event provider that the pipeline has started
+type runningProvider struct {
+	raw      json.RawMessage
+	provider provider.EventProvider
+	status   provider.Status
+
+	// the provider failed after it was started, so it still holds what Start acquired
+	failed bool
+}
+
+// check marks the provider as stopped if it has failed since it was started, and returns true if it is still running
+func (r *runningProvider) check() bool {
+	if !r.status.Running {
+		return false
+	}
+
+	f, ok := r.provider.(provider.Failer)
+	if !ok {
+		return true
+	}
+
+	if err := f.Failed(); err != nil {
+		r.status.Running = false
+		r.status.Error = err.Error()
+		r.status.Since = time.Now().Unix()
+		r.failed = true
+	}
+
+	return r.status.Running
+}
+
+// sameConfig returns true if both raw configs hold the same values, regardless of formatting
+func sameConfig(a, b json.RawMessage) bool {
+	var x, y interface{}
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(x, y)
+}
+
+// refreshProviders stops every provider that was removed or changed, and starts every provider
+// that is new, changed, or has failed. Providers that haven't changed keep running
+func (p *Pipeline) refreshProviders(c *provider.EventProviderCollection) {
+	raw := c.Raw()
+	for name, r := range p.providers {
+		if n, ok := raw[name]; ok && sameConfig(n, r.raw) && r.check() {
+			continue
+		}
+
+		if r.status.Running || r.failed {
+			logrus.Infof("Stopping event provider %s", name)
+			err := r.provider.Stop()
+			if err != nil {
+				logrus.Errorf("Unable to stop event provider %s: %s", name, err)
+			}
+		}
+
+		delete(p.providers, name)
+	}
+
+	for name, ep := range c.Collection {
+		if _, ok := p.providers[name]; ok {
+			continue
+		}
+
+		logrus.Infof("Starting event provider %s", name)
+		r := &runningProvider{
+			raw:      raw[name],
+			provider: ep,
+		}
+
+		err := ep.Start(p)
+		r.status.Since = time.Now().Unix()
+		if err != nil {
+			logrus.Errorf("Unable to start event provider %s: %s", name, err)
+			r.status.Error = err.Error()
+		} else {
+			r.status.Running = true
+		}
+
+		p.providers[name] = r
+	}
+}
+
+// ProviderStatus returns the state of every event provider the pipeline has tried to start
+func (p *Pipeline) ProviderStatus() map[string]provider.Status {
+	p.confLock.Lock()
+	defer p.confLock.Unlock()
+
+	s := make(map[string]provider.Status, len(p.providers))
+	for name, r := range p.providers {
+		r.check()
+		status := r.status
+		if c, ok := r.provider.(provider.Counter); ok {
+			status.Counts = c.Counts()
+		}
+		s[name] = status
+	}
+
+	return s
+}
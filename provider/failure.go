@@ -0,0 +1,54 @@
+package provider
+
+import "sync"
+
+// A Failer is an EventProvider whose background work can stop after it has been started,
+// such as a listener that dies. Failed returns the error that stopped it
+type Failer interface {
+	Failed() error
+}
+
+// Failure keeps the error that stopped a provider after it was started. Providers embed it, begin
+// a new run in Start, end it in Stop, and report with the run their background work belongs to, so
+// errors caused by stopping the provider are never reported
+type Failure struct {
+	lock sync.Mutex
+	run  uint64
+	err  error
+}
+
+// Begin starts a new run, clearing the last failure, and returns its number
+func (f *Failure) Begin() uint64 {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.run++
+	f.err = nil
+	return f.run
+}
+
+// End ends the current run. Failures reported by its background work are ignored from now on
+func (f *Failure) End() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.run++
+}
+
+// Fail records the error if the run is still the current one. Only the first error is kept
+func (f *Failure) Fail(run uint64, err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if run == f.run && f.err == nil {
+		f.err = err
+	}
+}
+
+// Failed returns the error that stopped the current run, if any
+func (f *Failure) Failed() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.err
+}
@@ -0,0 +1,324 @@
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/eliothedeman/bangarang/event"
+	"github.com/eliothedeman/bangarang/provider"
+	"github.com/eliothedeman/bangarang/provider/graphite"
+)
+
+const (
+	FORMAT_JSON     = "json"
+	FORMAT_GRAPHITE = "graphite"
+
+	START_AT_END       = "end"
+	START_AT_BEGINNING = "beginning"
+
+	DEFAULT_POLL_INTERVAL = "1s"
+
+	COUNT_LINES     = "lines"
+	COUNT_MALFORMED = "malformed"
+)
+
+func init() {
+	provider.LoadEventProviderFactory("file", NewFileProvider)
+}
+
+// FileProvider tails files of newline separated events. Rotated and truncated files are read
+// again from the start, and the offsets can be saved so a restart picks up where it left off
+type FileProvider struct {
+	conf     *FileConfig
+	interval time.Duration
+	parse    func(line string) (*event.Event, error)
+	tailers  map[string]*tailer
+	offsets  map[string]*Offset
+	stop     chan struct{}
+	wg       sync.WaitGroup
+
+	// files found by the first poll are read from where start_at says, unless an offset was saved for them
+	polled bool
+
+	lines     uint64
+	malformed uint64
+}
+
+// FileConfig holds the options for the file provider
+type FileConfig struct {
+	// glob patterns of the files to tail, "/var/log/bangarang/*.log"
+	Paths []string `json:"paths" schema:"required"`
+
+	// "json" for an encoded event on each line, or "graphite" for "path value timestamp"
+	Format string `json:"format"`
+
+	// how the paths of graphite lines are turned into tags, the same as the graphite provider
+	Templates []string `json:"templates"`
+	PathTag   string   `json:"path_tag"`
+
+	PollInterval string `json:"poll_interval"`
+
+	// where files that already exist when the provider starts are read from, "end" or "beginning".
+	// Files created later, and files with a saved offset, aren't affected
+	StartAt string `json:"start_at"`
+
+	// where the read offsets are saved. They aren't saved if empty
+	OffsetsFile string `json:"offsets_file"`
+}
+
+func NewFileProvider() provider.EventProvider {
+	return &FileProvider{}
+}
+
+// ConfigStruct returns a struct of config options
+func (f *FileProvider) ConfigStruct() interface{} {
+	return &FileConfig{
+		Format:       FORMAT_JSON,
+		PathTag:      graphite.DEFAULT_PATH_TAG,
+		PollInterval: DEFAULT_POLL_INTERVAL,
+		StartAt:      START_AT_END,
+	}
+}
+
+// Init runs the config for the provider
+func (f *FileProvider) Init(i interface{}) error {
+	c, ok := i.(*FileConfig)
+	if !ok {
+		return fmt.Errorf("Incorrect config type. Expecting FileConfig not %+v", i)
+	}
+
+	if len(c.Paths) == 0 {
+		return fmt.Errorf("At least one path must be given")
+	}
+
+	for _, p := range c.Paths {
+		_, err := filepath.Match(p, "")
+		if err != nil {
+			return fmt.Errorf("Invalid path %s: %s", p, err)
+		}
+	}
+
+	switch c.Format {
+	case FORMAT_JSON:
+		dec := event.NewJsonDecoder()
+		f.parse = func(line string) (*event.Event, error) {
+			e := event.NewEvent()
+			return e, dec.Decode([]byte(line), e)
+		}
+
+	case FORMAT_GRAPHITE:
+		parser, err := graphite.NewParser(c.Templates, c.PathTag)
+		if err != nil {
+			return err
+		}
+		f.parse = parser.Parse
+
+	default:
+		return fmt.Errorf("Unknown format %s", c.Format)
+	}
+
+	if c.StartAt != START_AT_END && c.StartAt != START_AT_BEGINNING {
+		return fmt.Errorf("Unknown start_at %s, expecting %s or %s", c.StartAt, START_AT_END, START_AT_BEGINNING)
+	}
+
+	var err error
+	f.interval, err = time.ParseDuration(c.PollInterval)
+	if err != nil {
+		return err
+	}
+
+	if f.interval <= 0 {
+		return fmt.Errorf("The poll_interval must be greater than 0")
+	}
+
+	f.conf = c
+	return nil
+}
+
+// Start tailing the files
+func (f *FileProvider) Start(p event.EventPasser) error {
+	offsets, err := f.loadOffsets()
+	if err != nil {
+		return err
+	}
+
+	f.offsets = offsets
+	f.tailers = make(map[string]*tailer)
+	f.stop = make(chan struct{})
+	f.polled = false
+
+	logrus.Infof("File Provider tailing %s", strings.Join(f.conf.Paths, ", "))
+	f.wg.Add(1)
+	go f.pollEvery(f.stop, p)
+	return nil
+}
+
+// Stop tailing, and save the offsets
+func (f *FileProvider) Stop() error {
+	if f.stop == nil {
+		return nil
+	}
+
+	close(f.stop)
+	f.wg.Wait()
+	f.stop = nil
+	return nil
+}
+
+// Counts returns the number of lines read, and the number that could not be parsed
+func (f *FileProvider) Counts() map[string]uint64 {
+	return map[string]uint64{
+		COUNT_LINES:     atomic.LoadUint64(&f.lines),
+		COUNT_MALFORMED: atomic.LoadUint64(&f.malformed),
+	}
+}
+
+// loadOffsets reads the saved offsets, if there are any
+func (f *FileProvider) loadOffsets() (map[string]*Offset, error) {
+	offsets := make(map[string]*Offset)
+	if f.conf.OffsetsFile == "" {
+		return offsets, nil
+	}
+
+	buff, err := ioutil.ReadFile(f.conf.OffsetsFile)
+	if os.IsNotExist(err) {
+		return offsets, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(buff, &offsets)
+	return offsets, err
+}
+
+// saveOffsets writes the offsets to a temporary file, and moves it into place so they are never half written
+func (f *FileProvider) saveOffsets() error {
+	if f.conf.OffsetsFile == "" {
+		return nil
+	}
+
+	buff, err := json.Marshal(f.offsets)
+	if err != nil {
+		return err
+	}
+
+	tmp := f.conf.OffsetsFile + ".tmp"
+	err = ioutil.WriteFile(tmp, buff, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, f.conf.OffsetsFile)
+}
+
+// pollEvery reads what was added to the files on each interval, until stopped
+func (f *FileProvider) pollEvery(stop chan struct{}, p event.EventPasser) {
+	defer f.wg.Done()
+
+	t := time.NewTicker(f.interval)
+	defer t.Stop()
+
+	for {
+		f.poll(p)
+
+		select {
+		case <-stop:
+			for _, t := range f.tailers {
+				t.close()
+			}
+
+			err := f.saveOffsets()
+			if err != nil {
+				logrus.Errorf("Unable to save file offsets: %s", err)
+			}
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// poll reads every matched file once, following rotations and picking up new files
+func (f *FileProvider) poll(p event.EventPasser) {
+	matched := make(map[string]bool)
+	for _, pattern := range f.conf.Paths {
+		paths, _ := filepath.Glob(pattern)
+		for _, path := range paths {
+			matched[path] = true
+		}
+	}
+
+	// stop tailing files that are gone, once everything written to them has been read
+	changed := false
+	for path, t := range f.tailers {
+		if !matched[path] || t.rotated() {
+			f.read(t, p)
+			t.close()
+			delete(f.tailers, path)
+			delete(f.offsets, path)
+			changed = true
+		}
+	}
+
+	for path := range matched {
+		t, ok := f.tailers[path]
+		if !ok {
+			var err error
+			t, err = openTailer(path, f.offsets[path], !f.polled && f.conf.StartAt == START_AT_END)
+			if err != nil {
+				logrus.Errorf("Unable to tail %s: %s", path, err)
+				continue
+			}
+			f.tailers[path] = t
+		}
+
+		f.read(t, p)
+		saved := t.saved()
+		if old, ok := f.offsets[path]; !ok || *old != *saved {
+			f.offsets[path] = saved
+			changed = true
+		}
+	}
+
+	f.polled = true
+	if !changed {
+		return
+	}
+
+	err := f.saveOffsets()
+	if err != nil {
+		logrus.Errorf("Unable to save file offsets: %s", err)
+	}
+}
+
+// read passes on every new line of the file
+func (f *FileProvider) read(t *tailer, p event.EventPasser) {
+	err := t.read(func(line string) {
+		if strings.TrimSpace(line) == "" {
+			return
+		}
+
+		atomic.AddUint64(&f.lines, 1)
+		e, err := f.parse(line)
+		if err != nil {
+			atomic.AddUint64(&f.malformed, 1)
+			logrus.Debugf("Unable to parse line of %s: %s", t.path, err)
+			return
+		}
+
+		p.PassEvent(e)
+	})
+
+	if err != nil {
+		logrus.Errorf("Unable to read %s: %s", t.path, err)
+	}
+}
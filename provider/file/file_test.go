@@ -0,0 +1,319 @@
+package file
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eliothedeman/bangarang/event"
+)
+
+type testPasser struct {
+	in chan *event.Event
+}
+
+func (t *testPasser) PassEvent(e *event.Event) {
+	t.in <- e
+}
+
+func newTestPasser() *testPasser {
+	return &testPasser{
+		in: make(chan *event.Event, 100),
+	}
+}
+
+func newTestFile(t *testing.T, dir, format string) *FileProvider {
+	f := NewFileProvider().(*FileProvider)
+	conf := f.ConfigStruct().(*FileConfig)
+	conf.Paths = []string{filepath.Join(dir, "*.log")}
+	conf.Format = format
+	conf.Templates = []string{"servers.{host}.{service}"}
+	conf.OffsetsFile = filepath.Join(dir, "offsets.json")
+	err := f.Init(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.offsets, err = f.loadOffsets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.tailers = make(map[string]*tailer)
+	return f
+}
+
+func jsonLine(t *testing.T, host string) string {
+	e := event.NewEvent()
+	e.Tags.Set("host", host)
+	buff, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buff) + "\n"
+}
+
+func appendFile(t *testing.T, path, s string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// hosts returns the host of every event that has been passed on
+func hosts(tp *testPasser) []string {
+	var h []string
+	for {
+		select {
+		case e := <-tp.in:
+			h = append(h, e.Get("host"))
+		default:
+			return h
+		}
+	}
+}
+
+func expectHosts(t *testing.T, tp *testPasser, expect ...string) {
+	got := hosts(tp)
+	if len(got) != len(expect) {
+		t.Fatalf("Expected %v, got %v", expect, got)
+	}
+
+	for i := range got {
+		if got[i] != expect[i] {
+			t.Fatalf("Expected %v, got %v", expect, got)
+		}
+	}
+}
+
+func TestTail(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "bangarang-file")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.log")
+	f := newTestFile(t, dir, FORMAT_JSON)
+	tp := newTestPasser()
+
+	f.poll(tp)
+
+	// the unfinished line is left until it is finished
+	line := jsonLine(t, "b")
+	appendFile(t, path, jsonLine(t, "a")+line[:10])
+	f.poll(tp)
+	expectHosts(t, tp, "a")
+
+	appendFile(t, path, line[10:]+"not json\n")
+	f.poll(tp)
+	expectHosts(t, tp, "b")
+
+	if f.Counts()[COUNT_MALFORMED] != 1 {
+		t.Fatalf("Expected 1 malformed line, got %+v", f.Counts())
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "bangarang-file")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.log")
+	f := newTestFile(t, dir, FORMAT_JSON)
+	tp := newTestPasser()
+
+	f.poll(tp)
+	appendFile(t, path, jsonLine(t, "a")+jsonLine(t, "b"))
+	f.poll(tp)
+	expectHosts(t, tp, "a", "b")
+
+	err := os.Truncate(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appendFile(t, path, jsonLine(t, "c"))
+	f.poll(tp)
+	expectHosts(t, tp, "c")
+}
+
+func TestRotate(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "bangarang-file")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.log")
+	f := newTestFile(t, dir, FORMAT_JSON)
+	tp := newTestPasser()
+
+	f.poll(tp)
+	appendFile(t, path, jsonLine(t, "a"))
+	f.poll(tp)
+	expectHosts(t, tp, "a")
+
+	// written just before the rotation, so it is only in the old file
+	appendFile(t, path, jsonLine(t, "b"))
+	err := os.Rename(path, filepath.Join(dir, "events.log.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appendFile(t, path, jsonLine(t, "c"))
+	f.poll(tp)
+	expectHosts(t, tp, "b", "c")
+}
+
+func TestResume(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "bangarang-file")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.log")
+	tp := newTestPasser()
+
+	f := newTestFile(t, dir, FORMAT_GRAPHITE)
+	f.poll(tp)
+	appendFile(t, path, "servers.a.cpu 1 -1\n")
+	f.poll(tp)
+	expectHosts(t, tp, "a")
+	for _, tl := range f.tailers {
+		tl.close()
+	}
+
+	// a new provider picks up after what was already read
+	appendFile(t, path, "servers.b.cpu 1 -1\n")
+	f = newTestFile(t, dir, FORMAT_GRAPHITE)
+	f.poll(tp)
+	expectHosts(t, tp, "b")
+	for _, tl := range f.tailers {
+		tl.close()
+	}
+
+	// unless the file was replaced
+	os.Remove(path)
+	appendFile(t, path, "servers.c.cpu 1 -1\nservers.d.cpu 1 -1\n")
+	f = newTestFile(t, dir, FORMAT_GRAPHITE)
+	f.poll(tp)
+	expectHosts(t, tp, "c", "d")
+}
+
+func TestStartAtEnd(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "bangarang-file")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.log")
+	line := jsonLine(t, "b")
+	appendFile(t, path, jsonLine(t, "a")+line[:10])
+
+	// what was written before the provider started is skipped, except for the unfinished line
+	f := newTestFile(t, dir, FORMAT_JSON)
+	tp := newTestPasser()
+	f.poll(tp)
+	expectHosts(t, tp)
+
+	appendFile(t, path, line[10:])
+	f.poll(tp)
+	expectHosts(t, tp, "b")
+
+	// files created later are read from the start
+	appendFile(t, filepath.Join(dir, "new.log"), jsonLine(t, "c"))
+	f.poll(tp)
+	expectHosts(t, tp, "c")
+}
+
+func TestStartAtBeginning(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "bangarang-file")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.log")
+	appendFile(t, path, jsonLine(t, "a")+jsonLine(t, "b"))
+
+	f := newTestFile(t, dir, FORMAT_JSON)
+	f.conf.StartAt = START_AT_BEGINNING
+	tp := newTestPasser()
+	f.poll(tp)
+	expectHosts(t, tp, "a", "b")
+
+	conf := f.ConfigStruct().(*FileConfig)
+	conf.Paths = []string{path}
+	conf.StartAt = "middle"
+	if f.Init(conf) == nil {
+		t.Error("Expected an error for an unknown start_at")
+	}
+}
+
+func TestTruncateAndGrow(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "bangarang-file")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.log")
+	f := newTestFile(t, dir, FORMAT_JSON)
+	tp := newTestPasser()
+
+	f.poll(tp)
+	appendFile(t, path, jsonLine(t, "a"))
+	f.poll(tp)
+	expectHosts(t, tp, "a")
+
+	// rewritten past the old offset between polls
+	err := os.Truncate(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appendFile(t, path, jsonLine(t, "bb")+jsonLine(t, "cc"))
+	f.poll(tp)
+	expectHosts(t, tp, "bb", "cc")
+}
+
+func TestStartStop(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "bangarang-file")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.log")
+	appendFile(t, path, jsonLine(t, "a"))
+	f := newTestFile(t, dir, FORMAT_JSON)
+	tp := newTestPasser()
+
+	// resume from the start of the file, instead of its end
+	head := sha1.Sum(nil)
+	f.offsets[path] = &Offset{Head: hex.EncodeToString(head[:])}
+	err := f.saveOffsets()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = f.Start(tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := <-tp.in
+	if e.Get("host") != "a" {
+		t.Fatalf("Unexpected event %s", e.Tags)
+	}
+
+	err = f.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = os.Stat(filepath.Join(dir, "offsets.json"))
+	if err != nil {
+		t.Fatalf("Expected the offsets to be saved: %s", err)
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	f := NewFileProvider()
+	conf := f.ConfigStruct().(*FileConfig)
+	conf.Paths = []string{"/tmp/*.log"}
+	conf.Format = "nope"
+	if f.Init(conf) == nil {
+		t.Fatal("Expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,188 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"os"
+)
+
+const (
+	// the number of bytes at the start of a file used to tell if it is still the same file after a restart
+	HEAD_SIZE = 256
+)
+
+// Offset is how far into a file has been read, saved so a restart can resume from it
+type Offset struct {
+	Offset int64 `json:"offset"`
+
+	// a hash of the start of the file, to notice when it has been replaced
+	Head string `json:"head"`
+}
+
+// tailer reads the complete lines that are added to a single file
+type tailer struct {
+	path   string
+	file   *os.File
+	info   os.FileInfo
+	offset int64
+	head   string
+}
+
+// hashHead returns the hash of the start of the file, up to the given size
+func hashHead(f *os.File, size int64) (string, error) {
+	if size > HEAD_SIZE {
+		size = HEAD_SIZE
+	}
+
+	buff := make([]byte, size)
+	_, err := f.ReadAt(buff, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	sum := sha1.Sum(buff)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// lastLineEnd returns the offset just after the last complete line of the file
+func lastLineEnd(f *os.File, size int64) (int64, error) {
+	buff := make([]byte, HEAD_SIZE)
+	for end := size; end > 0; {
+		start := end - int64(len(buff))
+		if start < 0 {
+			start = 0
+		}
+
+		n, err := f.ReadAt(buff[:end-start], start)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		if i := bytes.LastIndexByte(buff[:n], '\n'); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+
+		end = start
+	}
+
+	return 0, nil
+}
+
+// openTailer opens the file, and resumes from the saved offset if it is still the same file. Files
+// without a saved offset are read from the start, or from their last complete line if fromEnd is set
+func openTailer(path string, saved *Offset, fromEnd bool) (*tailer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	t := &tailer{
+		path: path,
+		file: f,
+		info: info,
+	}
+
+	if saved != nil && saved.Offset <= info.Size() {
+		head, err := hashHead(f, saved.Offset)
+		if err == nil && head == saved.Head {
+			t.offset = saved.Offset
+			t.head = saved.Head
+		}
+		return t, nil
+	}
+
+	if saved == nil && fromEnd {
+		t.offset, err = lastLineEnd(f, info.Size())
+		if err == nil {
+			t.head, err = hashHead(f, t.offset)
+		}
+
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// saved returns the offset of the tailer to be saved
+func (t *tailer) saved() *Offset {
+	return &Offset{
+		Offset: t.offset,
+		Head:   t.head,
+	}
+}
+
+// read calls f for every complete line after the offset. A line that hasn't been finished yet is left for the next read
+func (t *tailer) read(f func(line string)) error {
+	info, err := t.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// the file was truncated, start over. A file that was truncated and written past the offset
+	// again has a different head
+	if info.Size() < t.offset {
+		t.offset = 0
+	} else if t.offset > 0 {
+		head, err := hashHead(t.file, t.offset)
+		if err != nil {
+			return err
+		}
+
+		if head != t.head {
+			t.offset = 0
+		}
+	}
+
+	_, err = t.file.Seek(t.offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(t.file)
+	start := t.offset
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			break
+		}
+
+		t.offset += int64(len(line))
+		f(line[:len(line)-1])
+	}
+
+	// the head only needs to be hashed again while it is still growing
+	if start < HEAD_SIZE && t.offset > start {
+		t.head, err = hashHead(t.file, t.offset)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rotated returns true if the path now points to a different file
+func (t *tailer) rotated() bool {
+	info, err := os.Stat(t.path)
+	if err != nil {
+		return true
+	}
+
+	return !os.SameFile(t.info, info)
+}
+
+func (t *tailer) close() error {
+	return t.file.Close()
+}
@@ -0,0 +1,324 @@
+package graphite
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/eliothedeman/bangarang/event"
+	"github.com/eliothedeman/bangarang/provider"
+)
+
+const (
+	DEFAULT_PATH_TAG        = "path"
+	DEFAULT_MAX_PACKET_SIZE = 65535
+
+	COUNT_RECEIVED  = "received"
+	COUNT_MALFORMED = "malformed"
+)
+
+func init() {
+	provider.LoadEventProviderFactory("graphite", NewGraphiteProvider)
+}
+
+// Parser turns lines of the carbon plaintext protocol, "path value timestamp", into events
+type Parser struct {
+	Templates []*Template
+
+	// the tag the whole path is kept in when no template matches
+	PathTag string
+}
+
+// NewParser compiles the templates. They are tried in order, and the first one that matches is used
+func NewParser(templates []string, pathTag string) (*Parser, error) {
+	p := &Parser{
+		Templates: make([]*Template, len(templates)),
+		PathTag:   pathTag,
+	}
+
+	if p.PathTag == "" {
+		p.PathTag = DEFAULT_PATH_TAG
+	}
+
+	var err error
+	for i, raw := range templates {
+		p.Templates[i], err = NewTemplate(raw)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// Parse a single line. A timestamp of -1, or none at all, means now
+func (p *Parser) Parse(line string) (*event.Event, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return nil, fmt.Errorf("Malformed graphite line %q. Expecting \"path value timestamp\"", line)
+	}
+
+	metric, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid value in graphite line %q", line)
+	}
+
+	e := event.NewEvent()
+	e.Metric = metric
+	e.Time = time.Now()
+
+	if len(fields) == 3 {
+		ts, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid timestamp in graphite line %q", line)
+		}
+
+		if ts != -1 {
+			sec, frac := math.Modf(ts)
+			e.Time = time.Unix(int64(sec), int64(frac*float64(time.Second)))
+		}
+	}
+
+	path := strings.Split(fields[0], ".")
+	for _, t := range p.Templates {
+		if t.Apply(path, e.Tags) {
+			return e, nil
+		}
+	}
+
+	e.Tags.Set(p.PathTag, fields[0])
+	return e, nil
+}
+
+// GraphiteProvider accepts the carbon plaintext protocol over tcp and udp, so agents that already
+// write to graphite can be pointed at bangarang
+type GraphiteProvider struct {
+	conf   *GraphiteConfig
+	parser *Parser
+
+	tcpAddr  *net.TCPAddr
+	udpAddr  *net.UDPAddr
+	listener *net.TCPListener
+	udpConn  *net.UDPConn
+	conns    map[net.Conn]struct{}
+	sync.Mutex
+	provider.Failure
+
+	received  uint64
+	malformed uint64
+}
+
+// GraphiteConfig holds the options for the graphite provider. At least one of listen or listen_udp must be set
+type GraphiteConfig struct {
+	Listen    string `json:"listen"`
+	ListenUDP string `json:"listen_udp"`
+
+	// templates that map the segments of each path into tags, "servers.{host}.{service}"
+	Templates []string `json:"templates"`
+	PathTag   string   `json:"path_tag"`
+}
+
+func NewGraphiteProvider() provider.EventProvider {
+	return &GraphiteProvider{
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+// ConfigStruct returns a struct of config options
+func (g *GraphiteProvider) ConfigStruct() interface{} {
+	return &GraphiteConfig{
+		PathTag: DEFAULT_PATH_TAG,
+	}
+}
+
+// Init runs the config for the provider
+func (g *GraphiteProvider) Init(i interface{}) error {
+	c, ok := i.(*GraphiteConfig)
+	if !ok {
+		return fmt.Errorf("Incorrect config type. Expecting GraphiteConfig not %+v", i)
+	}
+
+	if c.Listen == "" && c.ListenUDP == "" {
+		return fmt.Errorf("One of listen or listen_udp must be set")
+	}
+
+	var err error
+	g.tcpAddr, g.udpAddr = nil, nil
+	if c.Listen != "" {
+		g.tcpAddr, err = net.ResolveTCPAddr("tcp", c.Listen)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.ListenUDP != "" {
+		g.udpAddr, err = net.ResolveUDPAddr("udp", c.ListenUDP)
+		if err != nil {
+			return err
+		}
+	}
+
+	g.parser, err = NewParser(c.Templates, c.PathTag)
+	if err != nil {
+		return err
+	}
+
+	g.conf = c
+	return nil
+}
+
+// Start listening on tcp and udp
+func (g *GraphiteProvider) Start(p event.EventPasser) error {
+	g.Lock()
+	defer g.Unlock()
+
+	run := g.Begin()
+
+	if g.tcpAddr != nil {
+		l, err := net.ListenTCP("tcp", g.tcpAddr)
+		if err != nil {
+			return err
+		}
+
+		logrus.Infof("Graphite Provider listening on tcp %s", l.Addr())
+		g.listener = l
+		go g.accept(l, p)
+	}
+
+	if g.udpAddr != nil {
+		c, err := net.ListenUDP("udp", g.udpAddr)
+		if err != nil {
+			if g.listener != nil {
+				g.listener.Close()
+				g.listener = nil
+			}
+			return err
+		}
+
+		logrus.Infof("Graphite Provider listening on udp %s", c.LocalAddr())
+		g.udpConn = c
+		go g.readUDP(c, p, run)
+	}
+
+	return nil
+}
+
+// Stop closes the listeners, and every connection that is still open
+func (g *GraphiteProvider) Stop() error {
+	g.Lock()
+	defer g.Unlock()
+
+	g.End()
+
+	var err error
+	if g.listener != nil {
+		err = g.listener.Close()
+		g.listener = nil
+	}
+
+	if g.udpConn != nil {
+		uerr := g.udpConn.Close()
+		if err == nil {
+			err = uerr
+		}
+		g.udpConn = nil
+	}
+
+	for c := range g.conns {
+		c.Close()
+	}
+
+	return err
+}
+
+// Counts returns the number of lines received, and the number that could not be parsed
+func (g *GraphiteProvider) Counts() map[string]uint64 {
+	return map[string]uint64{
+		COUNT_RECEIVED:  atomic.LoadUint64(&g.received),
+		COUNT_MALFORMED: atomic.LoadUint64(&g.malformed),
+	}
+}
+
+// closed returns true if the listener has been stopped
+func (g *GraphiteProvider) closed(l *net.TCPListener) bool {
+	g.Lock()
+	defer g.Unlock()
+	return g.listener != l
+}
+
+func (g *GraphiteProvider) accept(l *net.TCPListener, p event.EventPasser) {
+	for {
+		c, err := l.AcceptTCP()
+		if err != nil {
+			if g.closed(l) {
+				return
+			}
+			logrus.Errorf("Cannot accept new graphite connection %s", err.Error())
+			continue
+		}
+
+		go g.consume(c, p)
+	}
+}
+
+// consume reads lines from the connection until it is closed
+func (g *GraphiteProvider) consume(c net.Conn, p event.EventPasser) {
+	g.Lock()
+	g.conns[c] = struct{}{}
+	g.Unlock()
+
+	scanner := bufio.NewScanner(c)
+	for scanner.Scan() {
+		g.pass(scanner.Text(), p)
+	}
+
+	c.Close()
+
+	g.Lock()
+	delete(g.conns, c)
+	g.Unlock()
+}
+
+// readUDP reads datagrams until the connection is closed. Each datagram can hold many lines
+func (g *GraphiteProvider) readUDP(c *net.UDPConn, p event.EventPasser, run uint64) {
+	buff := make([]byte, DEFAULT_MAX_PACKET_SIZE)
+	for {
+		n, _, err := c.ReadFromUDP(buff)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			g.Fail(run, err)
+			return
+		}
+
+		for _, line := range bytes.Split(buff[:n], []byte("\n")) {
+			g.pass(string(line), p)
+		}
+	}
+}
+
+// pass parses the line and passes the event on. Blank lines are ignored
+func (g *GraphiteProvider) pass(line string, p event.EventPasser) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+
+	atomic.AddUint64(&g.received, 1)
+	e, err := g.parser.Parse(line)
+	if err != nil {
+		atomic.AddUint64(&g.malformed, 1)
+		logrus.Debug(err)
+		return
+	}
+
+	p.PassEvent(e)
+}
@@ -0,0 +1,142 @@
+package graphite
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/eliothedeman/bangarang/event"
+)
+
+var num = 3000
+
+type testPasser struct {
+	in chan *event.Event
+}
+
+func (t *testPasser) PassEvent(e *event.Event) {
+	t.in <- e
+}
+
+func TestParseTemplate(t *testing.T) {
+	p, err := NewParser([]string{"servers.{host}.{service}.{sub_service}", "apps.*.{app}"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := p.Parse("servers.web1.nginx.requests 12.5 1450000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.Get("host") != "web1" || e.Get("service") != "nginx" || e.Get("sub_service") != "requests" {
+		t.Fatalf("Unexpected tags %s", e.Tags)
+	}
+
+	if e.Metric != 12.5 || e.Time.Unix() != 1450000000 {
+		t.Fatalf("Unexpected metric %f at %s", e.Metric, e.Time)
+	}
+
+	// the extra segments are kept in the last tag
+	e, err = p.Parse("apps.prod.api.latency.p99 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.Get("app") != "api.latency.p99" {
+		t.Fatalf("Unexpected tags %s", e.Tags)
+	}
+}
+
+func TestParseFallback(t *testing.T) {
+	p, err := NewParser([]string{"servers.{host}.{service}"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"collectd.web1.load 1 -1", "servers.web1 1"} {
+		e, err := p.Parse(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if e.Get(DEFAULT_PATH_TAG) == "" || e.Get("host") != "" {
+			t.Fatalf("Expected only the path tag for %q, got %s", line, e.Tags)
+		}
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	p, _ := NewParser(nil, "")
+	for _, line := range []string{"path", "path nope 1", "path 1 nope", "path 1 2 3"} {
+		_, err := p.Parse(line)
+		if err == nil {
+			t.Fatalf("Expected an error for %q", line)
+		}
+	}
+}
+
+func TestInvalidTemplate(t *testing.T) {
+	for _, raw := range []string{"", "servers..{host}", "servers.{}", "servers.{host"} {
+		_, err := NewTemplate(raw)
+		if err == nil {
+			t.Fatalf("Expected an error for %q", raw)
+		}
+	}
+}
+
+func newTestGraphite(t *testing.T) (*GraphiteProvider, int) {
+	num += 1
+	g := NewGraphiteProvider().(*GraphiteProvider)
+	conf := g.ConfigStruct().(*GraphiteConfig)
+	conf.Listen = fmt.Sprintf("127.0.0.1:%d", 9099+num)
+	conf.ListenUDP = conf.Listen
+	conf.Templates = []string{"servers.{host}.{service}"}
+	err := g.Init(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return g, 9099 + num
+}
+
+func receive(t *testing.T, tp *testPasser, host string) {
+	select {
+	case e := <-tp.in:
+		if e.Get("host") != host {
+			t.Fatalf("Unexpected tags %s", e.Tags)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Event was never received")
+	}
+}
+
+func TestSend(t *testing.T) {
+	g, port := newTestGraphite(t)
+	tp := &testPasser{
+		in: make(chan *event.Event),
+	}
+
+	err := g.Start(tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Stop()
+
+	for _, network := range []string{"tcp", "udp"} {
+		c, err := net.Dial(network, fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fmt.Fprintf(c, "servers.%s.cpu 10 -1\nservers.%s.cpu 20 -1\n", network, network)
+		receive(t, tp, network)
+		receive(t, tp, network)
+		c.Close()
+	}
+
+	if g.Counts()[COUNT_RECEIVED] != 4 {
+		t.Fatalf("Expected 4 lines, got %+v", g.Counts())
+	}
+}
@@ -0,0 +1,82 @@
+package graphite
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/eliothedeman/bangarang/event"
+)
+
+const (
+	// matches any one segment of the path without capturing it
+	TEMPLATE_WILDCARD = "*"
+)
+
+// Template maps the dotted segments of a graphite path into tags. "servers.{host}.{service}"
+// sets the host and service tags of "servers.web1.nginx". Segments that aren't in braces must
+// match the path exactly, or be "*" to match anything. Paths with more segments than the
+// template keep the extra segments in the last tag, joined by dots
+type Template struct {
+	raw      string
+	segments []string
+	tags     []string
+}
+
+// NewTemplate parses the template
+func NewTemplate(raw string) (*Template, error) {
+	if raw == "" {
+		return nil, fmt.Errorf("Empty template")
+	}
+
+	t := &Template{
+		raw:      raw,
+		segments: strings.Split(raw, "."),
+	}
+
+	t.tags = make([]string, len(t.segments))
+	for i, s := range t.segments {
+		if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+			t.tags[i] = s[1 : len(s)-1]
+			if t.tags[i] == "" {
+				return nil, fmt.Errorf("Template %s has a tag with no name", raw)
+			}
+		} else if s == "" || strings.ContainsAny(s, "{}") {
+			return nil, fmt.Errorf("Template %s has an invalid segment %q", raw, s)
+		}
+	}
+
+	return t, nil
+}
+
+// String returns the template as it was given
+func (t *Template) String() string {
+	return t.raw
+}
+
+// Apply sets the tags of the path, and returns false if the path doesn't match the template
+func (t *Template) Apply(path []string, tags *event.TagSet) bool {
+	last := len(t.segments) - 1
+	if len(path) < len(t.segments) || (len(path) > len(t.segments) && t.tags[last] == "") {
+		return false
+	}
+
+	for i, s := range t.segments {
+		if t.tags[i] == "" && s != TEMPLATE_WILDCARD && s != path[i] {
+			return false
+		}
+	}
+
+	for i, name := range t.tags {
+		if name == "" {
+			continue
+		}
+
+		if i == last {
+			tags.Set(name, strings.Join(path[i:], "."))
+		} else {
+			tags.Set(name, path[i])
+		}
+	}
+
+	return true
+}
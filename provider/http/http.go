@@ -24,6 +24,8 @@ func init() {
 type HTTPProvider struct {
 	pool   *event.EncodingPool
 	listen string
+	server *std_http.Server
+	provider.Failure
 }
 
 func NewHTTPProvider() provider.EventProvider {
@@ -33,36 +35,16 @@ func NewHTTPProvider() provider.EventProvider {
 // the config struct for the HTTP provider
 type HTTPConfig struct {
 	Encoding    string `json:"encoding"`
-	Listen      string `json:"listen"`
+	Listen      string `json:"listen" schema:"required"`
 	MaxEncoders int    `json:"max_encoders"`
 }
 
+// Init checks the config. The port isn't bound until the provider is started
 func (t *HTTPProvider) Init(i interface{}) error {
 	conf := i.(*HTTPConfig)
 
-	// make sure the port is open
-	l, err := net.Listen("tcp", conf.Listen)
-	if err != nil {
-		logrus.Error(err)
-
-		// check to see if the busy port is due to another provider
-		resp, err := std_http.Get("http://" + conf.Listen + ENDPOINT + "?init_check=true")
-		if err != nil {
-			return err
-		}
-
-		buff, _ := ioutil.ReadAll(resp.Body)
-		if string(buff) != START_HANDSHAKE {
-			return err
-
-		}
-	}
-
-	// stop the test
-	err = l.Close()
-	if err != nil {
-		logrus.Error(err)
-		return err
+	if _, ok := event.EncoderFactories[conf.Encoding]; !ok {
+		return fmt.Errorf("Unknown encoding %s", conf.Encoding)
 	}
 
 	// update the providers litening address
@@ -80,17 +62,14 @@ func (t *HTTPProvider) ConfigStruct() interface{} {
 }
 
 // start accepting connections and consume each of them as they come in
-func (h *HTTPProvider) Start(p event.EventPasser) {
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Println("Recovered in f", r)
-		}
-	}()
-	std_http.HandleFunc(ENDPOINT, func(w std_http.ResponseWriter, r *std_http.Request) {
+func (h *HTTPProvider) Start(p event.EventPasser) error {
+	mux := std_http.NewServeMux()
+	mux.HandleFunc(ENDPOINT, func(w std_http.ResponseWriter, r *std_http.Request) {
 
 		// handle the case where a provider is restarting and needs to check if a listener is a bangarang provider or not
 		if r.URL.Query().Get("init_check") == "true" {
 			w.Write([]byte(START_HANDSHAKE))
+			return
 		}
 		buff, err := ioutil.ReadAll(r.Body)
 		if err != nil {
@@ -111,6 +90,36 @@ func (h *HTTPProvider) Start(p event.EventPasser) {
 		logrus.Debug("Done processing http event")
 	})
 
+	l, err := net.Listen("tcp", h.listen)
+	if err != nil {
+		return err
+	}
+
+	h.server = &std_http.Server{
+		Handler: mux,
+	}
+
 	logrus.Infof("Serving http listener on %s", h.listen)
-	logrus.Fatal(std_http.ListenAndServe(h.listen, nil))
+	run := h.Begin()
+	go func(s *std_http.Server) {
+		err := s.Serve(l)
+		if err != nil && err != std_http.ErrServerClosed {
+			logrus.Errorf("HTTP provider on %s stopped: %s", h.listen, err)
+			h.Fail(run, err)
+		}
+	}(h.server)
+
+	return nil
+}
+
+// Stop closes the listener, and every connection that is still open
+func (h *HTTPProvider) Stop() error {
+	h.End()
+	if h.server == nil {
+		return nil
+	}
+
+	err := h.server.Close()
+	h.server = nil
+	return err
 }
@@ -1,6 +1,9 @@
 package http
 
 import (
+	"io/ioutil"
+	"net"
+	std_http "net/http"
 	"testing"
 
 	"github.com/eliothedeman/bangarang/provider"
@@ -16,3 +19,59 @@ func TestNewHttp(t *testing.T) {
 		t.Error("HTTPProvider does not impliement provider.EventProvider")
 	}
 }
+
+func TestRestart(t *testing.T) {
+	h := NewHTTPProvider()
+	conf := h.ConfigStruct().(*HTTPConfig)
+	conf.Listen = "localhost:9088"
+	err := h.Init(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the provider must be able to start again on the same address once it has been stopped
+	for i := 0; i < 2; i++ {
+		err = h.Start(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := std_http.Get("http://localhost:9088" + ENDPOINT + "?init_check=true")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buff, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(buff) != START_HANDSHAKE {
+			t.Error(string(buff))
+		}
+
+		err = h.Stop()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestInitBusyPort(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// validating a config must not touch the port, even if it is taken
+	h := NewHTTPProvider()
+	conf := h.ConfigStruct().(*HTTPConfig)
+	conf.Listen = l.Addr().String()
+	err = h.Init(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if h.Start(nil) == nil {
+		h.Stop()
+		t.Error("Expected an error starting on a busy port")
+	}
+}
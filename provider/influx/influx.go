@@ -0,0 +1,305 @@
+package influx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	std_http "net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/eliothedeman/bangarang/event"
+	"github.com/eliothedeman/bangarang/provider"
+)
+
+const (
+	WRITE_ENDPOINT = "/write"
+	PING_ENDPOINT  = "/ping"
+
+	DEFAULT_MAX_PACKET_SIZE = 65535
+
+	// the largest write that will be read, before and after it is decompressed
+	MAX_REQUEST_SIZE = 25 << 20
+
+	COUNT_RECEIVED  = "received"
+	COUNT_MALFORMED = "malformed"
+)
+
+func init() {
+	provider.LoadEventProviderFactory("influx", NewInfluxProvider)
+}
+
+// InfluxProvider accepts influxdb line protocol over http and udp, so telegraf can write straight to bangarang
+type InfluxProvider struct {
+	conf      *InfluxConfig
+	parser    *Parser
+	precision time.Duration
+	udpAddr   *net.UDPAddr
+	server    *std_http.Server
+	udpConn   *net.UDPConn
+	sync.Mutex
+	provider.Failure
+
+	received  uint64
+	malformed uint64
+}
+
+// InfluxConfig holds the options for the influx provider. At least one of listen or listen_udp must be set
+type InfluxConfig struct {
+	Listen    string `json:"listen"`
+	ListenUDP string `json:"listen_udp"`
+
+	// the unit of the timestamps sent over udp, or over http without a precision parameter
+	Precision string `json:"precision"`
+
+	MeasurementTag string `json:"measurement_tag"`
+	FieldTag       string `json:"field_tag"`
+}
+
+func NewInfluxProvider() provider.EventProvider {
+	return &InfluxProvider{}
+}
+
+// ConfigStruct returns a struct of config options
+func (i *InfluxProvider) ConfigStruct() interface{} {
+	return &InfluxConfig{
+		Precision:      DEFAULT_PRECISION,
+		MeasurementTag: DEFAULT_MEASUREMENT_TAG,
+		FieldTag:       DEFAULT_FIELD_TAG,
+	}
+}
+
+// Init runs the config for the provider
+func (i *InfluxProvider) Init(c interface{}) error {
+	conf, ok := c.(*InfluxConfig)
+	if !ok {
+		return fmt.Errorf("Incorrect config type. Expecting InfluxConfig not %+v", c)
+	}
+
+	if conf.Listen == "" && conf.ListenUDP == "" {
+		return fmt.Errorf("One of listen or listen_udp must be set")
+	}
+
+	if conf.MeasurementTag == "" || conf.FieldTag == "" {
+		return fmt.Errorf("The measurement_tag and field_tag can't be empty")
+	}
+
+	var err error
+	i.precision, err = Precision(conf.Precision)
+	if err != nil {
+		return err
+	}
+
+	if conf.Listen != "" {
+		_, err = net.ResolveTCPAddr("tcp", conf.Listen)
+		if err != nil {
+			return err
+		}
+	}
+
+	i.udpAddr = nil
+	if conf.ListenUDP != "" {
+		i.udpAddr, err = net.ResolveUDPAddr("udp", conf.ListenUDP)
+		if err != nil {
+			return err
+		}
+	}
+
+	i.parser = &Parser{
+		MeasurementTag: conf.MeasurementTag,
+		FieldTag:       conf.FieldTag,
+	}
+	i.conf = conf
+	return nil
+}
+
+// Start listening on http and udp
+func (i *InfluxProvider) Start(p event.EventPasser) error {
+	i.Lock()
+	defer i.Unlock()
+
+	run := i.Begin()
+
+	if i.conf.Listen != "" {
+		l, err := net.Listen("tcp", i.conf.Listen)
+		if err != nil {
+			return err
+		}
+
+		mux := std_http.NewServeMux()
+		mux.HandleFunc(PING_ENDPOINT, func(w std_http.ResponseWriter, r *std_http.Request) {
+			w.WriteHeader(std_http.StatusNoContent)
+		})
+		mux.HandleFunc(WRITE_ENDPOINT, func(w std_http.ResponseWriter, r *std_http.Request) {
+			i.write(w, r, p)
+		})
+
+		i.server = &std_http.Server{
+			Handler: mux,
+		}
+
+		logrus.Infof("Influx Provider listening on http %s", l.Addr())
+		go func(s *std_http.Server) {
+			err := s.Serve(l)
+			if err != nil && err != std_http.ErrServerClosed {
+				logrus.Errorf("Influx provider on %s stopped: %s", l.Addr(), err)
+				i.Fail(run, err)
+			}
+		}(i.server)
+	}
+
+	if i.udpAddr != nil {
+		c, err := net.ListenUDP("udp", i.udpAddr)
+		if err != nil {
+			if i.server != nil {
+				i.server.Close()
+				i.server = nil
+			}
+			return err
+		}
+
+		logrus.Infof("Influx Provider listening on udp %s", c.LocalAddr())
+		i.udpConn = c
+		go i.readUDP(c, p, run)
+	}
+
+	return nil
+}
+
+// Stop closes the http server and the udp socket
+func (i *InfluxProvider) Stop() error {
+	i.Lock()
+	defer i.Unlock()
+
+	i.End()
+
+	var err error
+	if i.server != nil {
+		err = i.server.Close()
+		i.server = nil
+	}
+
+	if i.udpConn != nil {
+		uerr := i.udpConn.Close()
+		if err == nil {
+			err = uerr
+		}
+		i.udpConn = nil
+	}
+
+	return err
+}
+
+// Counts returns the number of lines received, and the number that could not be parsed
+func (i *InfluxProvider) Counts() map[string]uint64 {
+	return map[string]uint64{
+		COUNT_RECEIVED:  atomic.LoadUint64(&i.received),
+		COUNT_MALFORMED: atomic.LoadUint64(&i.malformed),
+	}
+}
+
+// parse the lines and pass on every event. Lines that can't be parsed are counted and skipped
+func (i *InfluxProvider) parse(body []byte, precision time.Duration, p event.EventPasser) error {
+	var first error
+	now := time.Now()
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		atomic.AddUint64(&i.received, 1)
+		events, err := i.parser.ParseLine(string(line), precision, now)
+		if err != nil {
+			atomic.AddUint64(&i.malformed, 1)
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+
+		for _, e := range events {
+			p.PassEvent(e)
+		}
+	}
+
+	return first
+}
+
+// write handles a write request in the same way as influxdb. The lines that can be parsed are
+// passed on even if others can't
+func (i *InfluxProvider) write(w std_http.ResponseWriter, r *std_http.Request, p event.EventPasser) {
+	if r.Method != "POST" {
+		std_http.Error(w, "Expecting POST", std_http.StatusMethodNotAllowed)
+		return
+	}
+
+	precision := i.precision
+	if q := r.URL.Query().Get("precision"); q != "" {
+		var err error
+		precision, err = Precision(q)
+		if err != nil {
+			std_http.Error(w, err.Error(), std_http.StatusBadRequest)
+			return
+		}
+	}
+
+	var body io.Reader = std_http.MaxBytesReader(w, r.Body, MAX_REQUEST_SIZE)
+
+	// telegraf compresses its writes by default
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			std_http.Error(w, err.Error(), std_http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+
+		body = io.LimitReader(gz, MAX_REQUEST_SIZE+1)
+	}
+
+	buff, err := ioutil.ReadAll(body)
+	if err != nil {
+		logrus.Error(err)
+		std_http.Error(w, err.Error(), std_http.StatusBadRequest)
+		return
+	}
+
+	if len(buff) > MAX_REQUEST_SIZE {
+		std_http.Error(w, fmt.Sprintf("Write is larger than the limit of %d bytes", MAX_REQUEST_SIZE), std_http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	err = i.parse(buff, precision, p)
+	if err != nil {
+		std_http.Error(w, err.Error(), std_http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(std_http.StatusNoContent)
+}
+
+// readUDP reads datagrams until the connection is closed. Each datagram can hold many lines
+func (i *InfluxProvider) readUDP(c *net.UDPConn, p event.EventPasser, run uint64) {
+	buff := make([]byte, DEFAULT_MAX_PACKET_SIZE)
+	for {
+		n, _, err := c.ReadFromUDP(buff)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			i.Fail(run, err)
+			return
+		}
+
+		err = i.parse(buff[:n], i.precision, p)
+		if err != nil {
+			logrus.Debug(err)
+		}
+	}
+}
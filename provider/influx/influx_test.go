@@ -0,0 +1,209 @@
+package influx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net"
+	std_http "net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eliothedeman/bangarang/event"
+)
+
+type testPasser struct {
+	in chan *event.Event
+}
+
+func (t *testPasser) PassEvent(e *event.Event) {
+	t.in <- e
+}
+
+func newTestParser() *Parser {
+	return &Parser{
+		MeasurementTag: DEFAULT_MEASUREMENT_TAG,
+		FieldTag:       DEFAULT_FIELD_TAG,
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	p := newTestParser()
+	events, err := p.ParseLine(`cpu,host=web1,region=us\ east usage=1.5,cores=4i,up=true,note="a b,c" 1450000000`, time.Second, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("Expected an event for each numeric field, got %d", len(events))
+	}
+
+	e := events[0]
+	if e.Get(DEFAULT_MEASUREMENT_TAG) != "cpu" || e.Get(DEFAULT_FIELD_TAG) != "usage" || e.Metric != 1.5 {
+		t.Fatalf("Unexpected event %s %f", e.Tags, e.Metric)
+	}
+
+	if e.Get("host") != "web1" || e.Get("region") != "us east" {
+		t.Fatalf("Unexpected tags %s", e.Tags)
+	}
+
+	if e.Time.Unix() != 1450000000 {
+		t.Fatalf("Unexpected time %s", e.Time)
+	}
+
+	if events[1].Get(DEFAULT_FIELD_TAG) != "cores" || events[1].Metric != 4 {
+		t.Fatalf("Unexpected event %s %f", events[1].Tags, events[1].Metric)
+	}
+}
+
+func TestParseDefaultTime(t *testing.T) {
+	now := time.Unix(100, 0)
+	events, err := newTestParser().ParseLine("mem free=10", time.Nanosecond, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !events[0].Time.Equal(now) {
+		t.Fatalf("Expected the default time, got %s", events[0].Time)
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	p := newTestParser()
+	for _, line := range []string{"cpu", "cpu usage", "cpu usage=x", "cpu,host usage=1", "cpu usage=1 nope", `cpu note="open`} {
+		_, err := p.ParseLine(line, time.Nanosecond, time.Now())
+		if err == nil {
+			t.Fatalf("Expected an error for %q", line)
+		}
+	}
+}
+
+func TestPrecision(t *testing.T) {
+	for p, d := range map[string]time.Duration{"": time.Nanosecond, "ms": time.Millisecond, "s": time.Second} {
+		got, err := Precision(p)
+		if err != nil || got != d {
+			t.Fatalf("Expected %s for %q, got %s %v", d, p, got, err)
+		}
+	}
+
+	_, err := Precision("days")
+	if err == nil {
+		t.Fatal("Expected an error for an unknown precision")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	i := NewInfluxProvider().(*InfluxProvider)
+	conf := i.ConfigStruct().(*InfluxConfig)
+	conf.Listen = "127.0.0.1:9454"
+	conf.ListenUDP = "127.0.0.1:9454"
+	err := i.Init(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tp := &testPasser{
+		in: make(chan *event.Event, 10),
+	}
+
+	err = i.Start(tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer i.Stop()
+
+	resp, err := std_http.Post(fmt.Sprintf("http://%s%s?precision=ms", conf.Listen, WRITE_ENDPOINT), "text/plain",
+		strings.NewReader("cpu,host=web1 usage=2 1450000000000\ncpu usage\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// the good line is still passed on
+	if resp.StatusCode != std_http.StatusBadRequest {
+		t.Fatalf("Expected a bad request for the malformed line, got %d", resp.StatusCode)
+	}
+
+	e := <-tp.in
+	if e.Get("host") != "web1" || e.Time.Unix() != 1450000000 {
+		t.Fatalf("Unexpected event %s at %s", e.Tags, e.Time)
+	}
+
+	c, err := net.Dial("udp", conf.ListenUDP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	fmt.Fprint(c, "cpu,host=web2 usage=3\n")
+	select {
+	case e = <-tp.in:
+		if e.Get("host") != "web2" {
+			t.Fatalf("Unexpected event %s", e.Tags)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Event was never received")
+	}
+
+	if i.Counts()[COUNT_MALFORMED] != 1 {
+		t.Fatalf("Expected 1 malformed line, got %+v", i.Counts())
+	}
+}
+
+func TestWriteGzip(t *testing.T) {
+	i := NewInfluxProvider().(*InfluxProvider)
+	conf := i.ConfigStruct().(*InfluxConfig)
+	conf.Listen = "127.0.0.1:9457"
+	err := i.Init(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tp := &testPasser{
+		in: make(chan *event.Event, 10),
+	}
+
+	err = i.Start(tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer i.Stop()
+
+	post := func(body []byte) int {
+		req, err := std_http.NewRequest("POST", fmt.Sprintf("http://%s%s", conf.Listen, WRITE_ENDPOINT), bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Encoding", "gzip")
+
+		resp, err := std_http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	compress := func(b []byte) []byte {
+		buff := bytes.NewBuffer(nil)
+		gz := gzip.NewWriter(buff)
+		gz.Write(b)
+		gz.Close()
+		return buff.Bytes()
+	}
+
+	if code := post(compress([]byte("cpu,host=web1 usage=2\n"))); code != std_http.StatusNoContent {
+		t.Fatalf("Unexpected status %d", code)
+	}
+
+	e := <-tp.in
+	if e.Get("host") != "web1" {
+		t.Fatalf("Unexpected event %s", e.Tags)
+	}
+
+	// a small body that decompresses to more than the limit
+	if code := post(compress(make([]byte, MAX_REQUEST_SIZE+1))); code != std_http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected the write to be rejected, got %d", code)
+	}
+}
@@ -0,0 +1,189 @@
+package influx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eliothedeman/bangarang/event"
+)
+
+const (
+	DEFAULT_MEASUREMENT_TAG = "measurement"
+	DEFAULT_FIELD_TAG       = "field"
+	DEFAULT_PRECISION       = "ns"
+)
+
+var (
+	precisions = map[string]time.Duration{
+		"n":  time.Nanosecond,
+		"ns": time.Nanosecond,
+		"u":  time.Microsecond,
+		"us": time.Microsecond,
+		"ms": time.Millisecond,
+		"s":  time.Second,
+		"m":  time.Minute,
+		"h":  time.Hour,
+	}
+)
+
+// Precision returns the unit of the timestamps for the precision, "ns", "us", "ms", "s", "m", or "h"
+func Precision(p string) (time.Duration, error) {
+	if p == "" {
+		p = DEFAULT_PRECISION
+	}
+
+	d, ok := precisions[p]
+	if !ok {
+		return 0, fmt.Errorf("Unknown precision %s", p)
+	}
+
+	return d, nil
+}
+
+// Parser turns influxdb line protocol, "measurement,tag=v field=1.2 ts", into events
+type Parser struct {
+	MeasurementTag string
+	FieldTag       string
+}
+
+// split splits the string on each separator that isn't escaped with a backslash. When quotes
+// is set, separators inside double quotes are also kept
+func split(s string, sep byte, quotes bool) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case quotes && s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+// unescape removes the backslashes from escaped characters
+func unescape(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+
+	buff := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		buff = append(buff, s[i])
+	}
+
+	return string(buff)
+}
+
+// keyValue splits "key=value" on its first unescaped equals sign
+func keyValue(s string) (string, string, error) {
+	kv := split(s, '=', false)
+	if len(kv) < 2 || kv[0] == "" {
+		return "", "", fmt.Errorf("Malformed key value pair %q", s)
+	}
+
+	return unescape(kv[0]), strings.Join(kv[1:], "="), nil
+}
+
+// parseNumber parses a numeric field value. Strings and booleans are not numbers
+func parseNumber(v string) (float64, bool, error) {
+	if v == "" {
+		return 0, false, fmt.Errorf("Empty field value")
+	}
+
+	switch v {
+	case "t", "T", "true", "True", "TRUE", "f", "F", "false", "False", "FALSE":
+		return 0, false, nil
+	}
+
+	if v[0] == '"' {
+		if len(v) < 2 || v[len(v)-1] != '"' {
+			return 0, false, fmt.Errorf("Unterminated string field %s", v)
+		}
+		return 0, false, nil
+	}
+
+	switch v[len(v)-1] {
+	case 'i':
+		i, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+		return float64(i), true, err
+	case 'u':
+		u, err := strconv.ParseUint(v[:len(v)-1], 10, 64)
+		return float64(u), true, err
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	return f, true, err
+}
+
+// ParseLine parses a single line into one event for each numeric field. Timestamps are in the unit of
+// the precision, and lines without one are given the default time
+func (p *Parser) ParseLine(line string, precision time.Duration, def time.Time) ([]*event.Event, error) {
+	sections := split(line, ' ', true)
+	if len(sections) < 2 || len(sections) > 3 {
+		return nil, fmt.Errorf("Malformed line %q. Expecting \"measurement,tag=v field=1.2 ts\"", line)
+	}
+
+	ts := def
+	if len(sections) == 3 {
+		n, err := strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid timestamp in line %q", line)
+		}
+
+		ts = time.Unix(0, n*int64(precision))
+	}
+
+	series := split(sections[0], ',', false)
+	measurement := unescape(series[0])
+	if measurement == "" {
+		return nil, fmt.Errorf("Missing measurement in line %q", line)
+	}
+
+	tags := make(event.TagSet, 0, len(series))
+	for _, t := range series[1:] {
+		k, v, err := keyValue(t)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, event.KeyVal{Key: k, Value: unescape(v)})
+	}
+
+	var events []*event.Event
+	for _, f := range split(sections[1], ',', true) {
+		k, v, err := keyValue(f)
+		if err != nil {
+			return nil, err
+		}
+
+		metric, numeric, err := parseNumber(v)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid value for field %s in line %q", k, line)
+		}
+
+		if !numeric {
+			continue
+		}
+
+		e := event.NewEvent()
+		e.Metric = metric
+		e.Time = ts
+		e.Tags.Set(p.MeasurementTag, measurement)
+		e.Tags.Set(p.FieldTag, k)
+		tags.ForEach(e.Tags.Set)
+		events = append(events, e)
+	}
+
+	return events, nil
+}
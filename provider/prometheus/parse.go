@@ -0,0 +1,141 @@
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eliothedeman/bangarang/event"
+)
+
+const (
+	NAME_LABEL = "__name__"
+
+	// the longest line of a scrape that can be read
+	MAX_LINE_SIZE = 1024 * 1024
+)
+
+// parseLabels parses the labels between the braces of a sample, `a="1",b="2"`, and returns the rest of the line
+func parseLabels(s string, tags *event.TagSet) (string, error) {
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if s == "" {
+			return "", fmt.Errorf("Unterminated labels")
+		}
+
+		if s[0] == '}' {
+			return s[1:], nil
+		}
+
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 || len(s) < eq+2 || s[eq+1] != '"' {
+			return "", fmt.Errorf("Malformed label %q", s)
+		}
+
+		name := strings.TrimSpace(s[:eq])
+		s = s[eq+2:]
+
+		// read the quoted value, handling escapes
+		var val []byte
+		closed := false
+		for i := 0; i < len(s); i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				if s[i] == 'n' {
+					val = append(val, '\n')
+				} else {
+					val = append(val, s[i])
+				}
+				continue
+			}
+
+			if s[i] == '"' {
+				s = s[i+1:]
+				closed = true
+				break
+			}
+
+			val = append(val, s[i])
+		}
+
+		if !closed {
+			return "", fmt.Errorf("Unterminated value for label %s", name)
+		}
+
+		tags.Set(name, string(val))
+	}
+}
+
+// ParseSample parses a single sample of the text exposition format, `name{label="v"} value [timestamp]`.
+// Samples without a timestamp are given the default time
+func ParseSample(line string, def time.Time) (*event.Event, error) {
+	e := event.NewEvent()
+	e.Time = def
+
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return nil, fmt.Errorf("Malformed sample %q", line)
+	}
+
+	e.Tags.Set(NAME_LABEL, line[:end])
+	rest := line[end:]
+	if rest[0] == '{' {
+		var err error
+		rest, err = parseLabels(rest[1:], e.Tags)
+		if err != nil {
+			return nil, fmt.Errorf("%s in sample %q", err, line)
+		}
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) < 1 || len(fields) > 2 {
+		return nil, fmt.Errorf("Malformed sample %q", line)
+	}
+
+	var err error
+	e.Metric, err = strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid value in sample %q", line)
+	}
+
+	if len(fields) == 2 {
+		ms, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid timestamp in sample %q", line)
+		}
+		e.Time = time.Unix(0, ms*int64(time.Millisecond))
+	}
+
+	return e, nil
+}
+
+// Parse reads every sample of the text exposition format. Comments, and samples that aren't a
+// number, are skipped
+func Parse(r io.Reader, def time.Time) ([]*event.Event, error) {
+	var events []*event.Event
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, MAX_LINE_SIZE)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		e, err := ParseSample(line, def)
+		if err != nil {
+			return nil, err
+		}
+
+		if math.IsNaN(e.Metric) {
+			continue
+		}
+
+		events = append(events, e)
+	}
+
+	return events, scanner.Err()
+}
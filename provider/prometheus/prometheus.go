@@ -0,0 +1,206 @@
+package prometheus
+
+import (
+	"fmt"
+	std_http "net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/eliothedeman/bangarang/event"
+	"github.com/eliothedeman/bangarang/provider"
+)
+
+const (
+	DEFAULT_INTERVAL = "15s"
+	DEFAULT_TIMEOUT  = "10s"
+
+	// the synthesized sample for each scrape, 1 if the target was scraped and 0 if it wasn't
+	UP_NAME = "up"
+
+	INSTANCE_LABEL = "instance"
+	JOB_LABEL      = "job"
+
+	ACCEPT_HEADER = "text/plain;version=0.0.4"
+)
+
+func init() {
+	provider.LoadEventProviderFactory("prometheus", NewPrometheusProvider)
+}
+
+// PrometheusProvider scrapes targets that expose metrics in the prometheus text format on an interval
+type PrometheusProvider struct {
+	conf     *PrometheusConfig
+	targets  []*url.URL
+	interval time.Duration
+	client   *std_http.Client
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// PrometheusConfig holds the options for the prometheus provider
+type PrometheusConfig struct {
+	// urls of the metrics endpoints, "http://localhost:9100/metrics"
+	Targets []string `json:"targets" schema:"required"`
+
+	Interval string `json:"interval"`
+	Timeout  string `json:"timeout"`
+
+	// added to every event as the job tag when set
+	Job string `json:"job"`
+}
+
+func NewPrometheusProvider() provider.EventProvider {
+	return &PrometheusProvider{}
+}
+
+// ConfigStruct returns a struct of config options
+func (p *PrometheusProvider) ConfigStruct() interface{} {
+	return &PrometheusConfig{
+		Interval: DEFAULT_INTERVAL,
+		Timeout:  DEFAULT_TIMEOUT,
+	}
+}
+
+// Init runs the config for the provider
+func (p *PrometheusProvider) Init(i interface{}) error {
+	c, ok := i.(*PrometheusConfig)
+	if !ok {
+		return fmt.Errorf("Incorrect config type. Expecting PrometheusConfig not %+v", i)
+	}
+
+	if len(c.Targets) == 0 {
+		return fmt.Errorf("At least one target must be given")
+	}
+
+	p.targets = make([]*url.URL, len(c.Targets))
+	for x, t := range c.Targets {
+		u, err := url.Parse(t)
+		if err != nil {
+			return err
+		}
+
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("Invalid target %s. Expecting an http or https url", t)
+		}
+
+		p.targets[x] = u
+	}
+
+	interval, err := time.ParseDuration(c.Interval)
+	if err != nil {
+		return err
+	}
+
+	timeout, err := time.ParseDuration(c.Timeout)
+	if err != nil {
+		return err
+	}
+
+	if interval <= 0 || timeout <= 0 {
+		return fmt.Errorf("The interval and timeout must be greater than 0")
+	}
+
+	p.conf = c
+	p.interval = interval
+	p.client = &std_http.Client{
+		Timeout: timeout,
+	}
+	return nil
+}
+
+// Start scraping every target on each interval
+func (p *PrometheusProvider) Start(e event.EventPasser) error {
+	p.stop = make(chan struct{})
+	for _, t := range p.targets {
+		p.wg.Add(1)
+		go p.scrapeEvery(t, p.stop, e)
+	}
+
+	logrus.Infof("Prometheus Provider scraping %d targets every %s", len(p.targets), p.interval)
+	return nil
+}
+
+// Stop scraping, and wait for any scrapes in progress to finish
+func (p *PrometheusProvider) Stop() error {
+	if p.stop == nil {
+		return nil
+	}
+
+	close(p.stop)
+	p.wg.Wait()
+	p.stop = nil
+	return nil
+}
+
+// scrapeEvery scrapes the target right away, then on each interval until stopped
+func (p *PrometheusProvider) scrapeEvery(target *url.URL, stop chan struct{}, e event.EventPasser) {
+	defer p.wg.Done()
+
+	t := time.NewTicker(p.interval)
+	defer t.Stop()
+
+	for {
+		p.scrape(target, e)
+
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// scrape passes on every sample of the target, followed by the up event for the target
+func (p *PrometheusProvider) scrape(target *url.URL, e event.EventPasser) {
+	now := time.Now()
+	events, err := p.fetch(target, now)
+
+	up := event.NewEvent()
+	up.Tags.Set(NAME_LABEL, UP_NAME)
+	up.Time = now
+	up.Metric = 1
+	if err != nil {
+		logrus.Errorf("Unable to scrape %s: %s", target, err)
+		up.Metric = 0
+		events = nil
+	}
+
+	for _, ev := range append(events, up) {
+		p.label(ev, target)
+		e.PassEvent(ev)
+	}
+}
+
+// label adds the instance and job tags to the event, unless the target already set them
+func (p *PrometheusProvider) label(e *event.Event, target *url.URL) {
+	if e.Get(INSTANCE_LABEL) == "" {
+		e.Tags.Set(INSTANCE_LABEL, target.Host)
+	}
+
+	if p.conf.Job != "" && e.Get(JOB_LABEL) == "" {
+		e.Tags.Set(JOB_LABEL, p.conf.Job)
+	}
+}
+
+// fetch scrapes the target, and parses its samples
+func (p *PrometheusProvider) fetch(target *url.URL, now time.Time) ([]*event.Event, error) {
+	req, err := std_http.NewRequest("GET", target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", ACCEPT_HEADER)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != std_http.StatusOK {
+		return nil, fmt.Errorf("Unexpected status %s", resp.Status)
+	}
+
+	return Parse(resp.Body, now)
+}
@@ -0,0 +1,155 @@
+package prometheus
+
+import (
+	"fmt"
+	std_http "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eliothedeman/bangarang/event"
+)
+
+const testExposition = `# HELP http_requests_total The total number of requests.
+# TYPE http_requests_total counter
+http_requests_total{method="post",code="200"} 1027 1395066363000
+http_requests_total{method="post",path="a \"b\"\n"} 3
+node_load1 0.5
+broken NaN
+`
+
+type testPasser struct {
+	in chan *event.Event
+}
+
+func (t *testPasser) PassEvent(e *event.Event) {
+	t.in <- e
+}
+
+func TestParse(t *testing.T) {
+	now := time.Now()
+	events, err := Parse(strings.NewReader(testExposition), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 samples, got %d", len(events))
+	}
+
+	e := events[0]
+	if e.Get(NAME_LABEL) != "http_requests_total" || e.Get("method") != "post" || e.Get("code") != "200" {
+		t.Fatalf("Unexpected tags %s", e.Tags)
+	}
+
+	if e.Metric != 1027 || e.Time.Unix() != 1395066363 {
+		t.Fatalf("Unexpected sample %f at %s", e.Metric, e.Time)
+	}
+
+	if events[1].Get("path") != "a \"b\"\n" {
+		t.Fatalf("Unexpected escaped label %q", events[1].Get("path"))
+	}
+
+	if events[2].Get(NAME_LABEL) != "node_load1" || !events[2].Time.Equal(now) {
+		t.Fatalf("Unexpected sample %s at %s", events[2].Tags, events[2].Time)
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	for _, line := range []string{"{a=\"b\"} 1", "m{a=\"b\" 1", "m{a=b} 1", "m nope", "m 1 nope"} {
+		_, err := ParseSample(line, time.Now())
+		if err == nil {
+			t.Fatalf("Expected an error for %q", line)
+		}
+	}
+}
+
+func newTestPrometheus(t *testing.T, targets ...string) *PrometheusProvider {
+	p := NewPrometheusProvider().(*PrometheusProvider)
+	conf := p.ConfigStruct().(*PrometheusConfig)
+	conf.Targets = targets
+	conf.Job = "node"
+	conf.Timeout = "500ms"
+	err := p.Init(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+// collect reads events until the up event for the target
+func collect(t *testing.T, tp *testPasser) []*event.Event {
+	var events []*event.Event
+	for {
+		select {
+		case e := <-tp.in:
+			events = append(events, e)
+			if e.Get(NAME_LABEL) == UP_NAME {
+				return events
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Scrape never finished")
+		}
+	}
+}
+
+func TestScrape(t *testing.T) {
+	s := httptest.NewServer(std_http.HandlerFunc(func(w std_http.ResponseWriter, r *std_http.Request) {
+		fmt.Fprint(w, testExposition)
+	}))
+	defer s.Close()
+
+	p := newTestPrometheus(t, s.URL+"/metrics")
+	tp := &testPasser{
+		in: make(chan *event.Event),
+	}
+
+	p.Start(tp)
+	defer p.Stop()
+
+	events := collect(t, tp)
+	if len(events) != 4 {
+		t.Fatalf("Expected 3 samples and an up event, got %d events", len(events))
+	}
+
+	for _, e := range events {
+		if e.Get(INSTANCE_LABEL) != strings.TrimPrefix(s.URL, "http://") || e.Get(JOB_LABEL) != "node" {
+			t.Fatalf("Unexpected tags %s", e.Tags)
+		}
+	}
+
+	if up := events[3]; up.Metric != 1 {
+		t.Fatalf("Expected the target to be up, got %f", up.Metric)
+	}
+}
+
+func TestScrapeDown(t *testing.T) {
+	s := httptest.NewServer(std_http.HandlerFunc(func(w std_http.ResponseWriter, r *std_http.Request) {
+		std_http.Error(w, "nope", std_http.StatusInternalServerError)
+	}))
+	defer s.Close()
+
+	p := newTestPrometheus(t, s.URL)
+	tp := &testPasser{
+		in: make(chan *event.Event),
+	}
+
+	p.Start(tp)
+	defer p.Stop()
+
+	events := collect(t, tp)
+	if len(events) != 1 || events[0].Metric != 0 {
+		t.Fatalf("Expected only a down event, got %d events", len(events))
+	}
+}
+
+func TestInvalidTarget(t *testing.T) {
+	p := NewPrometheusProvider()
+	conf := p.ConfigStruct().(*PrometheusConfig)
+	conf.Targets = []string{"localhost:9100"}
+	if p.Init(conf) == nil {
+		t.Fatal("Expected an error for a target that isn't a url")
+	}
+}
@@ -0,0 +1,278 @@
+package prometheus
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	std_http "net/http"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/eliothedeman/bangarang/event"
+	"github.com/eliothedeman/bangarang/provider"
+	"github.com/golang/snappy"
+)
+
+const (
+	REMOTE_WRITE_ENDPOINT = "/api/v1/write"
+
+	// keep only the series whose label matches the regex
+	RULE_KEEP = "keep"
+
+	// drop the series whose label matches the regex
+	RULE_DROP = "drop"
+
+	// remove every label whose name matches the regex
+	RULE_LABEL_DROP = "labeldrop"
+
+	// the largest request body that will be read, and the largest it may decode to
+	MAX_REQUEST_SIZE = 8 << 20
+	MAX_DECODED_SIZE = 32 << 20
+
+	COUNT_SAMPLES   = "samples"
+	COUNT_DROPPED   = "dropped"
+	COUNT_MALFORMED = "malformed"
+)
+
+func init() {
+	provider.LoadEventProviderFactory("prometheus_remote_write", NewRemoteWriteProvider)
+}
+
+// LabelRule filters the series of a remote write request before they become events. Rules are applied in order
+type LabelRule struct {
+	Action string `json:"action" schema:"required"`
+
+	// the label the regex is matched against, __name__ by default. Not used by labeldrop
+	Label string `json:"label"`
+
+	// matched against the whole value, or the whole label name for labeldrop
+	Regex string `json:"regex" schema:"required"`
+
+	regex *regexp.Regexp
+}
+
+// Compile checks the action and compiles the regex
+func (l *LabelRule) Compile() (err error) {
+	switch l.Action {
+	case RULE_KEEP, RULE_DROP, RULE_LABEL_DROP:
+	default:
+		return fmt.Errorf("Unknown label rule action %s", l.Action)
+	}
+
+	l.regex, err = regexp.Compile("^(?:" + l.Regex + ")$")
+	return err
+}
+
+// Apply the rule to the labels of a series, and return false if the series should be dropped
+func (l *LabelRule) Apply(labels []Label) ([]Label, bool) {
+	if l.Action == RULE_LABEL_DROP {
+		kept := labels[:0]
+		for _, lb := range labels {
+			if !l.regex.MatchString(lb.Name) {
+				kept = append(kept, lb)
+			}
+		}
+		return kept, true
+	}
+
+	name := l.Label
+	if name == "" {
+		name = NAME_LABEL
+	}
+
+	val := ""
+	for _, lb := range labels {
+		if lb.Name == name {
+			val = lb.Value
+			break
+		}
+	}
+
+	return labels, l.regex.MatchString(val) == (l.Action == RULE_KEEP)
+}
+
+// RemoteWriteProvider receives series from prometheus servers by remote write
+type RemoteWriteProvider struct {
+	conf   *RemoteWriteConfig
+	server *std_http.Server
+	provider.Failure
+
+	samples   uint64
+	dropped   uint64
+	malformed uint64
+}
+
+// RemoteWriteConfig holds the options for the remote write provider
+type RemoteWriteConfig struct {
+	Listen string       `json:"listen" schema:"required"`
+	Rules  []*LabelRule `json:"rules"`
+}
+
+func NewRemoteWriteProvider() provider.EventProvider {
+	return &RemoteWriteProvider{}
+}
+
+// ConfigStruct returns a struct of config options
+func (r *RemoteWriteProvider) ConfigStruct() interface{} {
+	return &RemoteWriteConfig{}
+}
+
+// Init runs the config for the provider
+func (r *RemoteWriteProvider) Init(i interface{}) error {
+	c, ok := i.(*RemoteWriteConfig)
+	if !ok {
+		return fmt.Errorf("Incorrect config type. Expecting RemoteWriteConfig not %+v", i)
+	}
+
+	_, err := net.ResolveTCPAddr("tcp", c.Listen)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range c.Rules {
+		err = rule.Compile()
+		if err != nil {
+			return err
+		}
+	}
+
+	r.conf = c
+	return nil
+}
+
+// Start serving the remote write endpoint
+func (r *RemoteWriteProvider) Start(p event.EventPasser) error {
+	l, err := net.Listen("tcp", r.conf.Listen)
+	if err != nil {
+		return err
+	}
+
+	mux := std_http.NewServeMux()
+	mux.HandleFunc(REMOTE_WRITE_ENDPOINT, func(w std_http.ResponseWriter, req *std_http.Request) {
+		r.write(w, req, p)
+	})
+
+	r.server = &std_http.Server{
+		Handler: mux,
+	}
+
+	logrus.Infof("Prometheus remote write Provider listening on %s", l.Addr())
+	run := r.Begin()
+	go func(s *std_http.Server) {
+		err := s.Serve(l)
+		if err != nil && err != std_http.ErrServerClosed {
+			logrus.Errorf("Prometheus remote write provider on %s stopped: %s", l.Addr(), err)
+			r.Fail(run, err)
+		}
+	}(r.server)
+
+	return nil
+}
+
+// Stop closes the http server
+func (r *RemoteWriteProvider) Stop() error {
+	r.End()
+	if r.server == nil {
+		return nil
+	}
+
+	err := r.server.Close()
+	r.server = nil
+	return err
+}
+
+// Counts returns the number of samples passed on, the number of series dropped by the rules, and
+// the number of requests that could not be decoded
+func (r *RemoteWriteProvider) Counts() map[string]uint64 {
+	return map[string]uint64{
+		COUNT_SAMPLES:   atomic.LoadUint64(&r.samples),
+		COUNT_DROPPED:   atomic.LoadUint64(&r.dropped),
+		COUNT_MALFORMED: atomic.LoadUint64(&r.malformed),
+	}
+}
+
+// write decodes the request and passes on a single event for each sample
+func (r *RemoteWriteProvider) write(w std_http.ResponseWriter, req *std_http.Request, p event.EventPasser) {
+	if req.Method != "POST" {
+		std_http.Error(w, "Expecting POST", std_http.StatusMethodNotAllowed)
+		return
+	}
+
+	compressed, err := ioutil.ReadAll(std_http.MaxBytesReader(w, req.Body, MAX_REQUEST_SIZE))
+	if err != nil {
+		logrus.Error(err)
+		std_http.Error(w, err.Error(), std_http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// check the size the request claims to decode to before allocating for it
+	n, err := snappy.DecodedLen(compressed)
+	if err != nil {
+		atomic.AddUint64(&r.malformed, 1)
+		std_http.Error(w, err.Error(), std_http.StatusBadRequest)
+		return
+	}
+
+	if n > MAX_DECODED_SIZE {
+		atomic.AddUint64(&r.malformed, 1)
+		std_http.Error(w, fmt.Sprintf("Request decodes to %d bytes, more than the limit of %d", n, MAX_DECODED_SIZE), std_http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	buff, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		atomic.AddUint64(&r.malformed, 1)
+		std_http.Error(w, err.Error(), std_http.StatusBadRequest)
+		return
+	}
+
+	series, err := UnmarshalWriteRequest(buff)
+	if err != nil {
+		atomic.AddUint64(&r.malformed, 1)
+		std_http.Error(w, err.Error(), std_http.StatusBadRequest)
+		return
+	}
+
+	for _, ts := range series {
+		for _, e := range r.events(ts) {
+			p.PassEvent(e)
+		}
+	}
+
+	w.WriteHeader(std_http.StatusNoContent)
+}
+
+// events applies the rules to the series, and turns each of its samples into an event
+func (r *RemoteWriteProvider) events(ts *TimeSeries) []*event.Event {
+	labels := ts.Labels
+	for _, rule := range r.conf.Rules {
+		var keep bool
+		labels, keep = rule.Apply(labels)
+		if !keep {
+			atomic.AddUint64(&r.dropped, 1)
+			return nil
+		}
+	}
+
+	events := make([]*event.Event, 0, len(ts.Samples))
+	for _, s := range ts.Samples {
+		// stale markers are NaN
+		if math.IsNaN(s.Value) {
+			continue
+		}
+
+		e := event.NewEvent()
+		e.Metric = s.Value
+		e.Time = time.Unix(0, s.Timestamp*int64(time.Millisecond))
+		for _, l := range labels {
+			e.Tags.Set(l.Name, l.Value)
+		}
+		events = append(events, e)
+	}
+
+	atomic.AddUint64(&r.samples, uint64(len(events)))
+	return events
+}
@@ -0,0 +1,216 @@
+package prometheus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	std_http "net/http"
+	"testing"
+	"time"
+
+	"github.com/eliothedeman/bangarang/event"
+	"github.com/golang/snappy"
+)
+
+// pbWriter encodes the remote write messages for the tests
+type pbWriter struct {
+	bytes.Buffer
+}
+
+func (w *pbWriter) varint(v uint64) {
+	buff := make([]byte, binary.MaxVarintLen64)
+	w.Write(buff[:binary.PutUvarint(buff, v)])
+}
+
+func (w *pbWriter) field(field, wire int) {
+	w.varint(uint64(field<<3 | wire))
+}
+
+func (w *pbWriter) bytes(field int, b []byte) {
+	w.field(field, wireBytes)
+	w.varint(uint64(len(b)))
+	w.Write(b)
+}
+
+func encodeWriteRequest(series ...*TimeSeries) []byte {
+	req := &pbWriter{}
+	for _, ts := range series {
+		s := &pbWriter{}
+		for _, l := range ts.Labels {
+			lw := &pbWriter{}
+			lw.bytes(1, []byte(l.Name))
+			lw.bytes(2, []byte(l.Value))
+			s.bytes(1, lw.Bytes())
+		}
+
+		for _, smp := range ts.Samples {
+			sw := &pbWriter{}
+			sw.field(1, wireFixed64)
+			b := make([]byte, 8)
+			binary.LittleEndian.PutUint64(b, math.Float64bits(smp.Value))
+			sw.Write(b)
+			sw.field(2, wireVarint)
+			sw.varint(uint64(smp.Timestamp))
+			s.bytes(2, sw.Bytes())
+		}
+
+		req.bytes(1, s.Bytes())
+	}
+
+	// metadata is skipped
+	req.bytes(3, []byte("ignored"))
+	return req.Bytes()
+}
+
+func testSeries() []*TimeSeries {
+	return []*TimeSeries{
+		{
+			Labels:  []Label{{NAME_LABEL, "up"}, {"instance", "web1"}, {"replica", "a"}},
+			Samples: []Sample{{1, 1450000000000}, {0, 1450000015000}},
+		},
+		{
+			Labels:  []Label{{NAME_LABEL, "go_goroutines"}, {"instance", "web1"}},
+			Samples: []Sample{{12, 1450000000000}},
+		},
+	}
+}
+
+func TestUnmarshalWriteRequest(t *testing.T) {
+	series, err := UnmarshalWriteRequest(encodeWriteRequest(testSeries()...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(series) != 2 || len(series[0].Labels) != 3 || len(series[0].Samples) != 2 {
+		t.Fatalf("Unexpected series %+v", series)
+	}
+
+	if series[0].Samples[1].Timestamp != 1450000015000 || series[1].Samples[0].Value != 12 {
+		t.Fatalf("Unexpected samples %+v %+v", series[0].Samples, series[1].Samples)
+	}
+
+	_, err = UnmarshalWriteRequest([]byte{0x0a, 0xff})
+	if err == nil {
+		t.Fatal("Expected an error for a truncated request")
+	}
+}
+
+func TestLabelRules(t *testing.T) {
+	r := NewRemoteWriteProvider().(*RemoteWriteProvider)
+	conf := r.ConfigStruct().(*RemoteWriteConfig)
+	conf.Listen = "127.0.0.1:0"
+	conf.Rules = []*LabelRule{
+		{Action: RULE_KEEP, Regex: "up|node_.*"},
+		{Action: RULE_LABEL_DROP, Regex: "replica"},
+	}
+	err := r.Init(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	series := testSeries()
+	events := r.events(series[0])
+	if len(events) != 2 || events[0].Get("replica") != "" || events[0].Get("instance") != "web1" {
+		t.Fatalf("Unexpected events %+v", events)
+	}
+
+	if events[1].Time.Unix() != 1450000015 {
+		t.Fatalf("Expected the sample time to be kept, got %s", events[1].Time)
+	}
+
+	if len(r.events(series[1])) != 0 || r.Counts()[COUNT_DROPPED] != 1 {
+		t.Fatalf("Expected the series to be dropped, got %+v", r.Counts())
+	}
+
+	conf.Rules = []*LabelRule{{Action: "nope", Regex: ".*"}}
+	if r.Init(conf) == nil {
+		t.Fatal("Expected an error for an unknown action")
+	}
+}
+
+func TestRemoteWrite(t *testing.T) {
+	r := NewRemoteWriteProvider().(*RemoteWriteProvider)
+	conf := r.ConfigStruct().(*RemoteWriteConfig)
+	conf.Listen = "127.0.0.1:9455"
+	conf.Rules = []*LabelRule{{Action: RULE_DROP, Regex: "go_.*"}}
+	err := r.Init(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tp := &testPasser{
+		in: make(chan *event.Event, 10),
+	}
+
+	err = r.Start(tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	url := "http://" + conf.Listen + REMOTE_WRITE_ENDPOINT
+	body := snappy.Encode(nil, encodeWriteRequest(testSeries()...))
+	resp, err := std_http.Post(url, "application/x-protobuf", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != std_http.StatusNoContent {
+		t.Fatalf("Unexpected status %d", resp.StatusCode)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case e := <-tp.in:
+			if e.Get(NAME_LABEL) != "up" {
+				t.Fatalf("Unexpected event %s", e.Tags)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Event was never received")
+		}
+	}
+
+	resp, err = std_http.Post(url, "application/x-protobuf", bytes.NewReader([]byte("not snappy")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != std_http.StatusBadRequest || r.Counts()[COUNT_MALFORMED] != 1 {
+		t.Fatalf("Expected a bad request, got %d %+v", resp.StatusCode, r.Counts())
+	}
+}
+
+func TestRemoteWriteTooLarge(t *testing.T) {
+	r := NewRemoteWriteProvider().(*RemoteWriteProvider)
+	conf := r.ConfigStruct().(*RemoteWriteConfig)
+	conf.Listen = "127.0.0.1:9458"
+	err := r.Init(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Start(&testPasser{in: make(chan *event.Event, 10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	url := "http://" + conf.Listen + REMOTE_WRITE_ENDPOINT
+
+	// a small body that claims to decode to more than the limit
+	header := make([]byte, binary.MaxVarintLen64)
+	header = header[:binary.PutUvarint(header, MAX_DECODED_SIZE+1)]
+	for _, body := range [][]byte{header, make([]byte, MAX_REQUEST_SIZE+1)} {
+		resp, err := std_http.Post(url, "application/x-protobuf", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != std_http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected the request to be rejected, got %d", resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package prometheus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// the protobuf wire types used by the remote write messages
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// Label is a single label of a remote write series
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a single value of a remote write series, at a time in milliseconds
+type Sample struct {
+	Value     float64
+	Timestamp int64
+}
+
+// TimeSeries is a single series of a remote write request
+type TimeSeries struct {
+	Labels  []Label
+	Samples []Sample
+}
+
+// pbReader reads the fields of a protobuf message. Only what the remote write messages use is supported
+type pbReader struct {
+	buff []byte
+}
+
+func (r *pbReader) varint() (uint64, error) {
+	v, n := binary.Uvarint(r.buff)
+	if n <= 0 {
+		return 0, fmt.Errorf("Malformed varint")
+	}
+	r.buff = r.buff[n:]
+	return v, nil
+}
+
+// next returns the number and wire type of the next field
+func (r *pbReader) next() (int, int, error) {
+	key, err := r.varint()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return int(key >> 3), int(key & 7), nil
+}
+
+// bytes reads a length delimited field
+func (r *pbReader) bytes() ([]byte, error) {
+	l, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+
+	if l > uint64(len(r.buff)) {
+		return nil, fmt.Errorf("Field length %d is longer than the message", l)
+	}
+
+	b := r.buff[:l]
+	r.buff = r.buff[l:]
+	return b, nil
+}
+
+func (r *pbReader) fixed64() (uint64, error) {
+	if len(r.buff) < 8 {
+		return 0, fmt.Errorf("Truncated fixed64")
+	}
+
+	v := binary.LittleEndian.Uint64(r.buff)
+	r.buff = r.buff[8:]
+	return v, nil
+}
+
+// skip a field that isn't needed
+func (r *pbReader) skip(wire int) error {
+	var err error
+	switch wire {
+	case wireVarint:
+		_, err = r.varint()
+	case wireFixed64:
+		_, err = r.fixed64()
+	case wireBytes:
+		_, err = r.bytes()
+	case wireFixed32:
+		if len(r.buff) < 4 {
+			return fmt.Errorf("Truncated fixed32")
+		}
+		r.buff = r.buff[4:]
+	default:
+		err = fmt.Errorf("Unsupported wire type %d", wire)
+	}
+
+	return err
+}
+
+// readFields calls f for each field of the message. f returns false for fields it doesn't read
+func readFields(buff []byte, f func(r *pbReader, field, wire int) (bool, error)) error {
+	r := &pbReader{buff: buff}
+	for len(r.buff) > 0 {
+		field, wire, err := r.next()
+		if err != nil {
+			return err
+		}
+
+		read, err := f(r, field, wire)
+		if err != nil {
+			return err
+		}
+
+		if !read {
+			err = r.skip(wire)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalWriteRequest decodes the series of a remote write request. Metadata, exemplars, and
+// native histograms are ignored
+func UnmarshalWriteRequest(buff []byte) ([]*TimeSeries, error) {
+	var series []*TimeSeries
+	err := readFields(buff, func(r *pbReader, field, wire int) (bool, error) {
+		if field != 1 || wire != wireBytes {
+			return false, nil
+		}
+
+		b, err := r.bytes()
+		if err != nil {
+			return true, err
+		}
+
+		ts, err := unmarshalTimeSeries(b)
+		if err != nil {
+			return true, err
+		}
+
+		series = append(series, ts)
+		return true, nil
+	})
+
+	return series, err
+}
+
+func unmarshalTimeSeries(buff []byte) (*TimeSeries, error) {
+	ts := &TimeSeries{}
+	err := readFields(buff, func(r *pbReader, field, wire int) (bool, error) {
+		if wire != wireBytes || (field != 1 && field != 2) {
+			return false, nil
+		}
+
+		b, err := r.bytes()
+		if err != nil {
+			return true, err
+		}
+
+		if field == 1 {
+			l, err := unmarshalLabel(b)
+			ts.Labels = append(ts.Labels, l)
+			return true, err
+		}
+
+		s, err := unmarshalSample(b)
+		ts.Samples = append(ts.Samples, s)
+		return true, err
+	})
+
+	return ts, err
+}
+
+func unmarshalLabel(buff []byte) (Label, error) {
+	l := Label{}
+	err := readFields(buff, func(r *pbReader, field, wire int) (bool, error) {
+		if wire != wireBytes || (field != 1 && field != 2) {
+			return false, nil
+		}
+
+		b, err := r.bytes()
+		if field == 1 {
+			l.Name = string(b)
+		} else {
+			l.Value = string(b)
+		}
+		return true, err
+	})
+
+	return l, err
+}
+
+func unmarshalSample(buff []byte) (Sample, error) {
+	s := Sample{}
+	err := readFields(buff, func(r *pbReader, field, wire int) (bool, error) {
+		switch {
+		case field == 1 && wire == wireFixed64:
+			v, err := r.fixed64()
+			s.Value = math.Float64frombits(v)
+			return true, err
+		case field == 2 && wire == wireVarint:
+			v, err := r.varint()
+			s.Timestamp = int64(v)
+			return true, err
+		}
+		return false, nil
+	})
+
+	return s, err
+}
@@ -17,7 +17,7 @@ var (
 type INVALID_PROVIDER_TYPE string
 
 func (i INVALID_PROVIDER_TYPE) Error() string {
-	return fmt.Sprintf("Unknown provider type: %s", i)
+	return fmt.Sprintf("Unknown provider type: %s", string(i))
 }
 
 type EventProviderCollection struct {
@@ -116,18 +116,41 @@ func LoadEventProviderFactory(name string, f EventProviderFactory) {
 	EVENT_PROVIDER_FACTORIES[name] = f
 }
 
-// Get an event provider by name
+// Get an event provider by name. Returns nil if the type is unknown
 func GetEventProvider(name string) EventProvider {
-	f := EVENT_PROVIDER_FACTORIES[name]
+	f, ok := EVENT_PROVIDER_FACTORIES[name]
+	if !ok {
+		return nil
+	}
 	return f()
 }
 
-// Provides an interface for injesting events from an outside service
+// Provides an interface for injesting events from an outside service. Start begins passing
+// events without blocking, and Stop releases everything Start acquired, so the provider can be
+// replaced when its config changes
 type EventProvider interface {
-	Start(event.EventPasser)
+	Start(event.EventPasser) error
+	Stop() error
 	ConfigStruct() interface{}
 	Init(interface{}) error
 }
 
+// A Counter is an EventProvider that keeps counts of what it has received, such as malformed input
+type Counter interface {
+	Counts() map[string]uint64
+}
+
+// Status is the state of an event provider that has been started
+type Status struct {
+	Running bool   `json:"running"`
+	Error   string `json:"error,omitempty"`
+
+	// when the provider last started or failed to
+	Since int64 `json:"since"`
+
+	// the counts kept by providers that are Counters
+	Counts map[string]uint64 `json:"counts,omitempty"`
+}
+
 // create and return a new EventProvider
 type EventProviderFactory func() EventProvider
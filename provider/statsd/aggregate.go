@@ -0,0 +1,187 @@
+package statsd
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eliothedeman/bangarang/event"
+)
+
+const (
+	STAT_COUNT  = "count"
+	STAT_RATE   = "rate"
+	STAT_VALUE  = "value"
+	STAT_MEAN   = "mean"
+	STAT_MEDIAN = "median"
+	STAT_MIN    = "min"
+	STAT_MAX    = "max"
+	STAT_SUM    = "sum"
+	STAT_STDDEV = "stddev"
+)
+
+// metric holds everything received for a single name, type, and set of tags during an interval
+type metric struct {
+	name   string
+	kind   string
+	tags   event.TagSet
+	count  float64
+	value  float64
+	values []float64
+	set    map[string]struct{}
+
+	// gauges are kept between intervals, but are only sent when they have been updated
+	updated bool
+}
+
+// aggregator collects samples, and turns them into events on each flush
+type aggregator struct {
+	nameTag     string
+	statTag     string
+	percentiles []float64
+	metrics     map[string]*metric
+	sync.Mutex
+}
+
+func newAggregator(nameTag, statTag string, percentiles []float64) *aggregator {
+	return &aggregator{
+		nameTag:     nameTag,
+		statTag:     statTag,
+		percentiles: percentiles,
+		metrics:     make(map[string]*metric),
+	}
+}
+
+// key identifies the metric the sample belongs to
+func key(s *Sample) string {
+	kind := s.Type
+	if kind == TYPE_HISTOGRAM {
+		kind = TYPE_TIMER
+	}
+
+	return s.Name + "|" + kind + "|" + s.Tags.String()
+}
+
+// add the sample to the current interval
+func (a *aggregator) add(s *Sample) {
+	a.Lock()
+	defer a.Unlock()
+
+	k := key(s)
+	m, ok := a.metrics[k]
+	if !ok {
+		m = &metric{
+			name: s.Name,
+			kind: s.Type,
+			tags: append(event.TagSet(nil), *s.Tags...),
+		}
+		if m.kind == TYPE_HISTOGRAM {
+			m.kind = TYPE_TIMER
+		}
+		a.metrics[k] = m
+	}
+
+	m.updated = true
+	switch m.kind {
+	case TYPE_COUNTER:
+		m.count += s.Value / s.Rate
+	case TYPE_GAUGE:
+		if s.Relative {
+			m.value += s.Value
+		} else {
+			m.value = s.Value
+		}
+	case TYPE_TIMER:
+		m.count += 1 / s.Rate
+		m.values = append(m.values, s.Value)
+	case TYPE_SET:
+		if m.set == nil {
+			m.set = make(map[string]struct{})
+		}
+		m.set[s.Raw] = struct{}{}
+	}
+}
+
+// percentileName names the stat of a percentile, "p90" or "p99_9"
+func percentileName(p float64) string {
+	return "p" + strings.Replace(strconv.FormatFloat(p, 'f', -1, 64), ".", "_", -1)
+}
+
+// percentile returns the nearest ranked value of the sorted values
+func percentile(sorted []float64, p float64) float64 {
+	i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// flush turns everything received since the last flush into events, and starts a new interval
+func (a *aggregator) flush(now time.Time, interval time.Duration) []*event.Event {
+	a.Lock()
+	defer a.Unlock()
+
+	var events []*event.Event
+	emit := func(m *metric, stat string, val float64) {
+		e := event.NewEvent()
+		e.Metric = val
+		e.Time = now
+		e.Tags.Set(a.nameTag, m.name)
+		e.Tags.Set(a.statTag, stat)
+		m.tags.ForEach(e.Tags.Set)
+		events = append(events, e)
+	}
+
+	for k, m := range a.metrics {
+		if !m.updated {
+			continue
+		}
+
+		switch m.kind {
+		case TYPE_COUNTER:
+			emit(m, STAT_COUNT, m.count)
+			emit(m, STAT_RATE, m.count/interval.Seconds())
+			delete(a.metrics, k)
+
+		case TYPE_GAUGE:
+			emit(m, STAT_VALUE, m.value)
+			m.updated = false
+
+		case TYPE_SET:
+			emit(m, STAT_COUNT, float64(len(m.set)))
+			delete(a.metrics, k)
+
+		case TYPE_TIMER:
+			sort.Float64s(m.values)
+
+			var sum float64
+			for _, v := range m.values {
+				sum += v
+			}
+			mean := sum / float64(len(m.values))
+
+			var variance float64
+			for _, v := range m.values {
+				variance += (v - mean) * (v - mean)
+			}
+
+			emit(m, STAT_COUNT, m.count)
+			emit(m, STAT_RATE, m.count/interval.Seconds())
+			emit(m, STAT_SUM, sum)
+			emit(m, STAT_MEAN, mean)
+			emit(m, STAT_MEDIAN, percentile(m.values, 50))
+			emit(m, STAT_MIN, m.values[0])
+			emit(m, STAT_MAX, m.values[len(m.values)-1])
+			emit(m, STAT_STDDEV, math.Sqrt(variance/float64(len(m.values))))
+			for _, p := range a.percentiles {
+				emit(m, percentileName(p), percentile(m.values, p))
+			}
+			delete(a.metrics, k)
+		}
+	}
+
+	return events
+}
@@ -0,0 +1,97 @@
+package statsd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/eliothedeman/bangarang/event"
+)
+
+const (
+	TYPE_COUNTER   = "c"
+	TYPE_GAUGE     = "g"
+	TYPE_TIMER     = "ms"
+	TYPE_HISTOGRAM = "h"
+	TYPE_SET       = "s"
+)
+
+// Sample is a single statsd metric, "name:value|type|@rate|#tag:value"
+type Sample struct {
+	Name  string
+	Type  string
+	Value float64
+
+	// the raw value, which is what sets count
+	Raw string
+
+	// gauges with a sign are added to the current value instead of replacing it
+	Relative bool
+
+	// the fraction of samples that were sent. Between 0 and 1
+	Rate float64
+
+	// dogstatsd tags. Tags with no value have an empty value
+	Tags *event.TagSet
+}
+
+// ParseLine parses a single statsd line
+func ParseLine(line string) (*Sample, error) {
+	colon := strings.LastIndex(strings.SplitN(line, "|", 2)[0], ":")
+	if colon <= 0 {
+		return nil, fmt.Errorf("Malformed statsd line %q. Expecting name:value|type", line)
+	}
+
+	s := &Sample{
+		Name: line[:colon],
+		Rate: 1,
+		Tags: &event.TagSet{},
+	}
+
+	parts := strings.Split(line[colon+1:], "|")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("Malformed statsd line %q. Expecting name:value|type", line)
+	}
+
+	s.Raw = parts[0]
+	s.Type = parts[1]
+	switch s.Type {
+	case TYPE_COUNTER, TYPE_GAUGE, TYPE_TIMER, TYPE_HISTOGRAM:
+		var err error
+		s.Value, err = strconv.ParseFloat(s.Raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid value in statsd line %q", line)
+		}
+
+		s.Relative = s.Type == TYPE_GAUGE && (s.Raw[0] == '+' || s.Raw[0] == '-')
+	case TYPE_SET:
+	default:
+		return nil, fmt.Errorf("Unknown statsd type %s in line %q", s.Type, line)
+	}
+
+	for _, p := range parts[2:] {
+		switch {
+		case strings.HasPrefix(p, "@"):
+			rate, err := strconv.ParseFloat(p[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return nil, fmt.Errorf("Invalid sample rate in statsd line %q", line)
+			}
+			s.Rate = rate
+
+		case strings.HasPrefix(p, "#"):
+			for _, t := range strings.Split(p[1:], ",") {
+				if t == "" {
+					continue
+				}
+
+				kv := strings.SplitN(t, ":", 2)
+				if len(kv) == 1 {
+					kv = append(kv, "")
+				}
+				s.Tags.Set(kv[0], kv[1])
+			}
+		}
+	}
+
+	return s, nil
+}
@@ -0,0 +1,209 @@
+package statsd
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/eliothedeman/bangarang/event"
+	"github.com/eliothedeman/bangarang/provider"
+)
+
+const (
+	DEFAULT_FLUSH_INTERVAL  = "10s"
+	DEFAULT_NAME_TAG        = "name"
+	DEFAULT_MAX_PACKET_SIZE = 65535
+
+	// the tag that holds which aggregate of the metric the event is, "count" or "p99"
+	STAT_TAG = "stat"
+
+	COUNT_RECEIVED  = "received"
+	COUNT_MALFORMED = "malformed"
+)
+
+var (
+	DEFAULT_PERCENTILES = []float64{90, 99}
+)
+
+func init() {
+	provider.LoadEventProviderFactory("statsd", NewStatsdProvider)
+}
+
+// StatsdProvider receives statsd metrics over udp, and passes their aggregates on once per flush interval
+type StatsdProvider struct {
+	conf     *StatsdConfig
+	laddr    *net.UDPAddr
+	interval time.Duration
+	agg      *aggregator
+	conn     *net.UDPConn
+	stop     chan struct{}
+	wg       sync.WaitGroup
+	provider.Failure
+
+	received  uint64
+	malformed uint64
+}
+
+// StatsdConfig holds the options for the statsd provider
+type StatsdConfig struct {
+	Listen        string `json:"listen" schema:"required"`
+	FlushInterval string `json:"flush_interval"`
+
+	// the percentiles of each timer that are sent, 90 is sent as "p90"
+	Percentiles []float64 `json:"percentiles"`
+
+	// the tag that holds the name of the metric
+	NameTag string `json:"name_tag"`
+}
+
+func NewStatsdProvider() provider.EventProvider {
+	return &StatsdProvider{}
+}
+
+// ConfigStruct returns a struct of config options
+func (s *StatsdProvider) ConfigStruct() interface{} {
+	return &StatsdConfig{
+		FlushInterval: DEFAULT_FLUSH_INTERVAL,
+		Percentiles:   DEFAULT_PERCENTILES,
+		NameTag:       DEFAULT_NAME_TAG,
+	}
+}
+
+// Init runs the config for the provider
+func (s *StatsdProvider) Init(i interface{}) error {
+	c, ok := i.(*StatsdConfig)
+	if !ok {
+		return fmt.Errorf("Incorrect config type. Expecting StatsdConfig not %+v", i)
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", c.Listen)
+	if err != nil {
+		return err
+	}
+
+	interval, err := time.ParseDuration(c.FlushInterval)
+	if err != nil {
+		return err
+	}
+
+	if interval <= 0 {
+		return fmt.Errorf("The flush_interval must be greater than 0")
+	}
+
+	for _, p := range c.Percentiles {
+		if p <= 0 || p > 100 {
+			return fmt.Errorf("Invalid percentile %f. Expecting a number between 0 and 100", p)
+		}
+	}
+
+	if c.NameTag == "" || c.NameTag == STAT_TAG {
+		return fmt.Errorf("The name_tag can't be empty or %s", STAT_TAG)
+	}
+
+	s.conf = c
+	s.laddr = addr
+	s.interval = interval
+	s.agg = newAggregator(c.NameTag, STAT_TAG, c.Percentiles)
+	return nil
+}
+
+// Start listening for metrics, and flushing them on each interval
+func (s *StatsdProvider) Start(p event.EventPasser) error {
+	conn, err := net.ListenUDP("udp", s.laddr)
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("Statsd Provider listening on %s", conn.LocalAddr())
+	s.conn = conn
+	s.stop = make(chan struct{})
+
+	s.wg.Add(2)
+	go s.read(conn, s.Begin())
+	go s.flushEvery(s.stop, p)
+	return nil
+}
+
+// Stop closes the socket, and passes on what was received in the current interval
+func (s *StatsdProvider) Stop() error {
+	s.End()
+	if s.conn == nil {
+		return nil
+	}
+
+	err := s.conn.Close()
+	close(s.stop)
+	s.wg.Wait()
+	s.conn = nil
+	return err
+}
+
+// Counts returns the number of lines received, and the number that could not be parsed
+func (s *StatsdProvider) Counts() map[string]uint64 {
+	return map[string]uint64{
+		COUNT_RECEIVED:  atomic.LoadUint64(&s.received),
+		COUNT_MALFORMED: atomic.LoadUint64(&s.malformed),
+	}
+}
+
+// read datagrams until the connection is closed. Each datagram can hold many lines
+func (s *StatsdProvider) read(conn *net.UDPConn, run uint64) {
+	defer s.wg.Done()
+
+	buff := make([]byte, DEFAULT_MAX_PACKET_SIZE)
+	for {
+		n, _, err := conn.ReadFromUDP(buff)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			s.Fail(run, err)
+			return
+		}
+
+		for _, line := range bytes.Split(buff[:n], []byte("\n")) {
+			line = bytes.TrimSpace(line)
+			if len(line) == 0 {
+				continue
+			}
+
+			atomic.AddUint64(&s.received, 1)
+			sample, err := ParseLine(string(line))
+			if err != nil {
+				atomic.AddUint64(&s.malformed, 1)
+				logrus.Debug(err)
+				continue
+			}
+
+			s.agg.add(sample)
+		}
+	}
+}
+
+// flushEvery passes on the aggregates on each interval, and once more when stopped
+func (s *StatsdProvider) flushEvery(stop chan struct{}, p event.EventPasser) {
+	defer s.wg.Done()
+
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-stop:
+			s.flush(p)
+			return
+		case <-t.C:
+			s.flush(p)
+		}
+	}
+}
+
+func (s *StatsdProvider) flush(p event.EventPasser) {
+	for _, e := range s.agg.flush(time.Now(), s.interval) {
+		p.PassEvent(e)
+	}
+}
@@ -0,0 +1,179 @@
+package statsd
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/eliothedeman/bangarang/event"
+)
+
+type testPasser struct {
+	in chan *event.Event
+}
+
+func (t *testPasser) PassEvent(e *event.Event) {
+	t.in <- e
+}
+
+func TestParseLine(t *testing.T) {
+	s, err := ParseLine("api.requests:2|c|@0.5|#env:prod,canary")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Name != "api.requests" || s.Type != TYPE_COUNTER || s.Value != 2 || s.Rate != 0.5 {
+		t.Fatalf("Unexpected sample %+v", s)
+	}
+
+	if s.Tags.Get("env") != "prod" || s.Tags.Len() != 2 {
+		t.Fatalf("Unexpected tags %s", s.Tags)
+	}
+
+	s, err = ParseLine("queue.depth:-3|g")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !s.Relative || s.Value != -3 {
+		t.Fatalf("Expected a relative gauge, got %+v", s)
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	for _, line := range []string{"nope", "a:1", "a:x|c", "a:1|q", "a:1|c|@2", ":1|c"} {
+		_, err := ParseLine(line)
+		if err == nil {
+			t.Fatalf("Expected an error for %q", line)
+		}
+	}
+}
+
+// stats returns the events by name and stat
+func stats(events []*event.Event) map[string]float64 {
+	m := make(map[string]float64)
+	for _, e := range events {
+		m[e.Get(DEFAULT_NAME_TAG)+"."+e.Get(STAT_TAG)] = e.Metric
+	}
+	return m
+}
+
+func add(t *testing.T, a *aggregator, lines ...string) {
+	for _, l := range lines {
+		s, err := ParseLine(l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.add(s)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	a := newAggregator(DEFAULT_NAME_TAG, STAT_TAG, DEFAULT_PERCENTILES)
+	add(t, a,
+		"hits:1|c", "hits:1|c|@0.5",
+		"temp:10|g", "temp:+5|g",
+		"users:bob|s", "users:alice|s", "users:bob|s",
+	)
+	for i := 1; i <= 100; i++ {
+		add(t, a, fmt.Sprintf("latency:%d|ms", i))
+	}
+
+	m := stats(a.flush(time.Now(), 10*time.Second))
+	expect := map[string]float64{
+		"hits.count":     3,
+		"hits.rate":      0.3,
+		"temp.value":     15,
+		"users.count":    2,
+		"latency.count":  100,
+		"latency.mean":   50.5,
+		"latency.min":    1,
+		"latency.max":    100,
+		"latency.median": 50,
+		"latency.p90":    90,
+		"latency.p99":    99,
+	}
+
+	for k, v := range expect {
+		if m[k] != v {
+			t.Fatalf("Expected %s to be %f, got %f", k, v, m[k])
+		}
+	}
+
+	// only gauges are kept, and only sent again when updated
+	if len(a.flush(time.Now(), time.Second)) != 0 {
+		t.Fatal("Expected nothing to be sent for an empty interval")
+	}
+
+	add(t, a, "temp:-1|g")
+	m = stats(a.flush(time.Now(), time.Second))
+	if m["temp.value"] != 14 {
+		t.Fatalf("Expected the gauge to be 14, got %f", m["temp.value"])
+	}
+}
+
+func TestAggregateTags(t *testing.T) {
+	a := newAggregator(DEFAULT_NAME_TAG, STAT_TAG, nil)
+	add(t, a, "hits:1|c|#env:prod,host:a", "hits:1|c|#host:a,env:prod", "hits:1|c|#env:dev")
+
+	events := a.flush(time.Now(), time.Second)
+	for _, e := range events {
+		if e.Get(STAT_TAG) != STAT_COUNT {
+			continue
+		}
+
+		if e.Get("env") == "prod" && e.Metric != 2 || e.Get("env") == "dev" && e.Metric != 1 {
+			t.Fatalf("Unexpected count %f for %s", e.Metric, e.Tags)
+		}
+	}
+
+	if len(events) != 4 {
+		t.Fatalf("Expected 2 counters with 2 stats each, got %d events", len(events))
+	}
+}
+
+func TestSend(t *testing.T) {
+	s := NewStatsdProvider().(*StatsdProvider)
+	conf := s.ConfigStruct().(*StatsdConfig)
+	conf.Listen = "127.0.0.1:9453"
+	conf.FlushInterval = "50ms"
+	err := s.Init(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tp := &testPasser{
+		in: make(chan *event.Event),
+	}
+
+	err = s.Start(tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	c, err := net.Dial("udp", conf.Listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	fmt.Fprint(c, "hits:4|c\nnope\n")
+
+	select {
+	case e := <-tp.in:
+		if e.Get(DEFAULT_NAME_TAG) != "hits" {
+			t.Fatalf("Unexpected event %s", e.Tags)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Event was never received")
+	}
+
+	// drain the rate event
+	<-tp.in
+
+	if s.Counts()[COUNT_MALFORMED] != 1 {
+		t.Fatalf("Expected 1 malformed line, got %+v", s.Counts())
+	}
+}
@@ -0,0 +1,202 @@
+package syslog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	RFC3164_TIMESTAMP = time.Stamp
+	NIL_VALUE         = "-"
+)
+
+var (
+	facilities = []string{
+		"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+		"uucp", "cron", "authpriv", "ftp", "ntp", "audit", "alert", "clock",
+		"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+	}
+	severities = []string{
+		"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug",
+	}
+)
+
+// Message is a parsed syslog message
+type Message struct {
+	Facility  int
+	Severity  int
+	Timestamp time.Time
+	Hostname  string
+	AppName   string
+	Message   string
+}
+
+// FacilityName returns the name of the facility, "daemon" or "local0"
+func (m *Message) FacilityName() string {
+	if m.Facility < len(facilities) {
+		return facilities[m.Facility]
+	}
+	return strconv.Itoa(m.Facility)
+}
+
+// SeverityName returns the name of the severity, "err" or "info"
+func (m *Message) SeverityName() string {
+	return severities[m.Severity]
+}
+
+// parsePriority reads the "<PRI>" at the start of the message
+func parsePriority(s string) (int, string, error) {
+	end := strings.IndexByte(s, '>')
+	if len(s) < 3 || s[0] != '<' || end < 2 || end > 4 {
+		return 0, "", fmt.Errorf("Missing priority")
+	}
+
+	pri, err := strconv.Atoi(s[1:end])
+	if err != nil || pri > 191 {
+		return 0, "", fmt.Errorf("Invalid priority %s", s[1:end])
+	}
+
+	return pri, s[end+1:], nil
+}
+
+// Parse parses a message in either RFC5424 or RFC3164 format. Times without a year, as in
+// RFC3164, are given the year of now. A message without a hostname is left for the caller to fill in
+func Parse(raw string, now time.Time) (*Message, error) {
+	raw = strings.TrimRight(raw, "\r\n\x00")
+	pri, rest, err := parsePriority(raw)
+	if err != nil {
+		return nil, fmt.Errorf("Malformed syslog message %q: %s", raw, err)
+	}
+
+	m := &Message{
+		Facility: pri / 8,
+		Severity: pri % 8,
+	}
+
+	if strings.HasPrefix(rest, "1 ") {
+		err = parse5424(m, rest[2:], now)
+	} else {
+		err = parse3164(m, rest, now)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Malformed syslog message %q: %s", raw, err)
+	}
+
+	return m, nil
+}
+
+// parse5424 parses "TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG"
+func parse5424(m *Message, s string, now time.Time) error {
+	fields := strings.SplitN(s, " ", 6)
+	if len(fields) < 6 {
+		return fmt.Errorf("Missing header fields")
+	}
+
+	m.Timestamp = now
+	if fields[0] != NIL_VALUE {
+		t, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return err
+		}
+		m.Timestamp = t
+	}
+
+	if fields[1] != NIL_VALUE {
+		m.Hostname = fields[1]
+	}
+
+	if fields[2] != NIL_VALUE {
+		m.AppName = fields[2]
+	}
+
+	msg, err := skipStructuredData(fields[5])
+	if err != nil {
+		return err
+	}
+
+	// the message may start with a byte order mark
+	m.Message = strings.TrimPrefix(msg, "\ufeff")
+	return nil
+}
+
+// skipStructuredData returns what comes after the structured data
+func skipStructuredData(s string) (string, error) {
+	if strings.HasPrefix(s, NIL_VALUE) {
+		return strings.TrimPrefix(s[1:], " "), nil
+	}
+
+	for strings.HasPrefix(s, "[") {
+		quoted := false
+		end := -1
+		for i := 1; i < len(s) && end < 0; i++ {
+			switch {
+			case s[i] == '\\':
+				i++
+			case s[i] == '"':
+				quoted = !quoted
+			case s[i] == ']' && !quoted:
+				end = i
+			}
+		}
+
+		if end < 0 {
+			return "", fmt.Errorf("Unterminated structured data")
+		}
+
+		s = s[end+1:]
+	}
+
+	if s != "" && s[0] != ' ' {
+		return "", fmt.Errorf("Malformed structured data")
+	}
+
+	return strings.TrimPrefix(s, " "), nil
+}
+
+// parse3164 parses "Mmm dd hh:mm:ss HOSTNAME TAG: MSG". Many senders leave out the hostname, or
+// the timestamp entirely
+func parse3164(m *Message, s string, now time.Time) error {
+	m.Timestamp = now
+	if len(s) >= len(RFC3164_TIMESTAMP) {
+		t, err := time.ParseInLocation(RFC3164_TIMESTAMP, s[:len(RFC3164_TIMESTAMP)], now.Location())
+		if err == nil {
+			m.Timestamp = t.AddDate(now.Year(), 0, 0)
+
+			// a message from the end of last year
+			if m.Timestamp.After(now.AddDate(0, 1, 0)) {
+				m.Timestamp = m.Timestamp.AddDate(-1, 0, 0)
+			}
+
+			s = strings.TrimPrefix(s[len(RFC3164_TIMESTAMP):], " ")
+
+			// the hostname is the next word, unless it is the tag
+			sp := strings.IndexByte(s, ' ')
+			if sp > 0 && !isTag(s[:sp]) {
+				m.Hostname = s[:sp]
+				s = s[sp+1:]
+			}
+		}
+	}
+
+	// the tag is the app name, followed by an optional pid and a colon
+	sp := strings.IndexByte(s, ' ')
+	if sp > 0 && isTag(s[:sp]) {
+		tag := strings.TrimSuffix(s[:sp], ":")
+		if b := strings.IndexByte(tag, '['); b > 0 {
+			tag = tag[:b]
+		}
+		m.AppName = tag
+		s = s[sp+1:]
+	}
+
+	m.Message = s
+	return nil
+}
+
+// isTag returns true if the word is a tag, "sshd[123]:" or "cron:"
+func isTag(word string) bool {
+	return strings.HasSuffix(word, ":")
+}
@@ -0,0 +1,171 @@
+package syslog
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/eliothedeman/bangarang/event"
+)
+
+const (
+	TAG_HOST     = "host"
+	TAG_APP      = "app"
+	TAG_FACILITY = "facility"
+	TAG_SEVERITY = "severity"
+	TAG_RULE     = "rule"
+)
+
+// Rule turns the messages that match its pattern into events. Named groups of the pattern
+// become tags. When value names one of the groups, each matching message is passed on with the
+// number it captured as the metric. Otherwise matching messages are counted, and the count for
+// each host and app is passed on once per interval
+type Rule struct {
+	Name    string `json:"name" schema:"required"`
+	Pattern string `json:"pattern" schema:"required"`
+	Value   string `json:"value"`
+
+	regex *regexp.Regexp
+	value int
+}
+
+// Compile compiles the pattern, and finds the group that holds the value
+func (r *Rule) Compile() (err error) {
+	if r.Name == "" {
+		return fmt.Errorf("Every rule must have a name")
+	}
+
+	r.regex, err = regexp.Compile(r.Pattern)
+	if err != nil {
+		return fmt.Errorf("Rule %s: %s", r.Name, err)
+	}
+
+	r.value = -1
+	if r.Value != "" {
+		for i, name := range r.regex.SubexpNames() {
+			if name == r.Value {
+				r.value = i
+			}
+		}
+
+		if r.value < 0 {
+			return fmt.Errorf("Rule %s: the pattern has no group named %s", r.Name, r.Value)
+		}
+	}
+
+	return nil
+}
+
+// Counter returns true if the rule counts the messages it matches
+func (r *Rule) Counter() bool {
+	return r.value < 0
+}
+
+// extract returns the tags of the message if it matches, and the value it captured
+func (r *Rule) extract(m *Message) (*event.TagSet, float64, bool) {
+	match := r.regex.FindStringSubmatch(m.Message)
+	if match == nil {
+		return nil, 0, false
+	}
+
+	tags := &event.TagSet{}
+	tags.Set(TAG_RULE, r.Name)
+	tags.Set(TAG_HOST, m.Hostname)
+	tags.Set(TAG_APP, m.AppName)
+	tags.Set(TAG_FACILITY, m.FacilityName())
+	tags.Set(TAG_SEVERITY, m.SeverityName())
+
+	for i, name := range r.regex.SubexpNames() {
+		if name != "" && i != r.value {
+			tags.Set(name, match[i])
+		}
+	}
+
+	if r.Counter() {
+		return tags, 0, true
+	}
+
+	val, err := strconv.ParseFloat(match[r.value], 64)
+	if err != nil {
+		return nil, 0, false
+	}
+
+	return tags, val, true
+}
+
+// count is the number of messages a counter rule matched for a single set of tags
+type count struct {
+	tags *event.TagSet
+	n    float64
+}
+
+// extractor applies the rules to each message, and keeps the counts of the counter rules
+type extractor struct {
+	rules  []*Rule
+	counts map[string]*count
+	sync.Mutex
+}
+
+func newExtractor(rules []*Rule) *extractor {
+	return &extractor{
+		rules:  rules,
+		counts: make(map[string]*count),
+	}
+}
+
+// extract returns an event for each value rule the message matches, and counts it for each counter rule
+func (x *extractor) extract(m *Message) []*event.Event {
+	var events []*event.Event
+	for _, r := range x.rules {
+		tags, val, ok := r.extract(m)
+		if !ok {
+			continue
+		}
+
+		if !r.Counter() {
+			e := event.NewEvent()
+			e.Metric = val
+			e.Time = m.Timestamp
+			e.Tags = tags
+			events = append(events, e)
+			continue
+		}
+
+		key := tags.String()
+		x.Lock()
+		c, ok := x.counts[key]
+		if !ok {
+			c = &count{tags: tags}
+			x.counts[key] = c
+		}
+		c.n++
+		x.Unlock()
+	}
+
+	return events
+}
+
+// flush returns an event with the count of each group, and starts a new interval. Groups that
+// matched nothing are sent once with a count of 0, so incidents for them can resolve
+func (x *extractor) flush(now time.Time) []*event.Event {
+	x.Lock()
+	defer x.Unlock()
+
+	events := make([]*event.Event, 0, len(x.counts))
+	for k, c := range x.counts {
+		e := event.NewEvent()
+		e.Metric = c.n
+		e.Time = now
+		c.tags.ForEach(e.Tags.Set)
+		events = append(events, e)
+
+		if c.n == 0 {
+			delete(x.counts, k)
+		}
+		c.n = 0
+	}
+
+	return events
+}
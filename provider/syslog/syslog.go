@@ -0,0 +1,408 @@
+package syslog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/eliothedeman/bangarang/event"
+	"github.com/eliothedeman/bangarang/provider"
+)
+
+const (
+	DEFAULT_INTERVAL = "1m"
+
+	// the largest message that is read, over tcp or udp
+	MAX_MESSAGE_SIZE = 65535
+
+	// the number of digits in MAX_MESSAGE_SIZE
+	MAX_LENGTH_DIGITS = 5
+
+	COUNT_RECEIVED  = "received"
+	COUNT_MALFORMED = "malformed"
+)
+
+func init() {
+	provider.LoadEventProviderFactory("syslog", NewSyslogProvider)
+}
+
+// SyslogProvider receives syslog messages over tcp and udp, and turns them into events by its rules
+type SyslogProvider struct {
+	conf      *SyslogConfig
+	interval  time.Duration
+	extractor *extractor
+	tcpAddr   *net.TCPAddr
+	udpAddr   *net.UDPAddr
+	listener  *net.TCPListener
+	udpConn   *net.UDPConn
+	conns     map[net.Conn]struct{}
+	stop      chan struct{}
+	done      chan struct{}
+
+	// every goroutine that reads messages
+	wg sync.WaitGroup
+	sync.Mutex
+	provider.Failure
+
+	received  uint64
+	malformed uint64
+}
+
+// SyslogConfig holds the options for the syslog provider. At least one of listen or listen_udp must be set
+type SyslogConfig struct {
+	Listen    string `json:"listen"`
+	ListenUDP string `json:"listen_udp"`
+
+	// how often the counts of the counter rules are passed on
+	Interval string  `json:"interval"`
+	Rules    []*Rule `json:"rules"`
+
+	// pass every message on as an event, with its severity as the metric
+	Messages bool `json:"messages"`
+}
+
+func NewSyslogProvider() provider.EventProvider {
+	return &SyslogProvider{
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+// ConfigStruct returns a struct of config options
+func (s *SyslogProvider) ConfigStruct() interface{} {
+	return &SyslogConfig{
+		Interval: DEFAULT_INTERVAL,
+	}
+}
+
+// Init runs the config for the provider
+func (s *SyslogProvider) Init(i interface{}) error {
+	c, ok := i.(*SyslogConfig)
+	if !ok {
+		return fmt.Errorf("Incorrect config type. Expecting SyslogConfig not %+v", i)
+	}
+
+	if c.Listen == "" && c.ListenUDP == "" {
+		return fmt.Errorf("One of listen or listen_udp must be set")
+	}
+
+	var err error
+	s.tcpAddr, s.udpAddr = nil, nil
+	if c.Listen != "" {
+		s.tcpAddr, err = net.ResolveTCPAddr("tcp", c.Listen)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.ListenUDP != "" {
+		s.udpAddr, err = net.ResolveUDPAddr("udp", c.ListenUDP)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.interval, err = time.ParseDuration(c.Interval)
+	if err != nil {
+		return err
+	}
+
+	if s.interval <= 0 {
+		return fmt.Errorf("The interval must be greater than 0")
+	}
+
+	for _, r := range c.Rules {
+		err = r.Compile()
+		if err != nil {
+			return err
+		}
+	}
+
+	s.conf = c
+	s.extractor = newExtractor(c.Rules)
+	return nil
+}
+
+// Start listening on tcp and udp, and passing on the counts on each interval
+func (s *SyslogProvider) Start(p event.EventPasser) error {
+	s.Lock()
+	defer s.Unlock()
+
+	run := s.Begin()
+
+	if s.tcpAddr != nil {
+		l, err := net.ListenTCP("tcp", s.tcpAddr)
+		if err != nil {
+			return err
+		}
+
+		logrus.Infof("Syslog Provider listening on tcp %s", l.Addr())
+		s.listener = l
+		s.wg.Add(1)
+		go s.accept(l, p)
+	}
+
+	if s.udpAddr != nil {
+		c, err := net.ListenUDP("udp", s.udpAddr)
+		if err != nil {
+			if s.listener != nil {
+				s.listener.Close()
+				s.listener = nil
+			}
+			return err
+		}
+
+		logrus.Infof("Syslog Provider listening on udp %s", c.LocalAddr())
+		s.udpConn = c
+		s.wg.Add(1)
+		go s.readUDP(c, p, run)
+	}
+
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.flushEvery(s.stop, s.done, p)
+	return nil
+}
+
+// Stop closes the listeners, and every connection that is still open. The counts since the
+// last interval are passed on once every message has been read
+func (s *SyslogProvider) Stop() error {
+	s.Lock()
+	s.End()
+
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+		s.listener = nil
+	}
+
+	if s.udpConn != nil {
+		uerr := s.udpConn.Close()
+		if err == nil {
+			err = uerr
+		}
+		s.udpConn = nil
+	}
+
+	for c := range s.conns {
+		c.Close()
+	}
+
+	stop, done := s.stop, s.done
+	s.stop, s.done = nil, nil
+	s.Unlock()
+
+	s.wg.Wait()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+
+	return err
+}
+
+// Counts returns the number of messages received, and the number that could not be parsed
+func (s *SyslogProvider) Counts() map[string]uint64 {
+	return map[string]uint64{
+		COUNT_RECEIVED:  atomic.LoadUint64(&s.received),
+		COUNT_MALFORMED: atomic.LoadUint64(&s.malformed),
+	}
+}
+
+// closed returns true if the listener has been stopped
+func (s *SyslogProvider) closed(l *net.TCPListener) bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.listener != l
+}
+
+func (s *SyslogProvider) accept(l *net.TCPListener, p event.EventPasser) {
+	defer s.wg.Done()
+
+	for {
+		c, err := l.AcceptTCP()
+		if err != nil {
+			if s.closed(l) {
+				return
+			}
+			logrus.Errorf("Cannot accept new syslog connection %s", err.Error())
+			continue
+		}
+
+		s.wg.Add(1)
+		go s.consume(c, p)
+	}
+}
+
+// readFrame reads a single message from a stream. Messages are either prefixed with their
+// length, as in RFC6587, or end with a newline
+func readFrame(r *bufio.Reader) (string, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return "", err
+	}
+
+	if b[0] >= '0' && b[0] <= '9' {
+
+		// read no more of the length than a valid one could take up
+		n := 0
+		for x := 0; ; x++ {
+			c, err := r.ReadByte()
+			if err != nil {
+				return "", err
+			}
+
+			if c == ' ' {
+				break
+			}
+
+			if c < '0' || c > '9' || x == MAX_LENGTH_DIGITS {
+				return "", fmt.Errorf("Invalid message length")
+			}
+
+			n = n*10 + int(c-'0')
+		}
+
+		if n > MAX_MESSAGE_SIZE {
+			return "", fmt.Errorf("Invalid message length %d", n)
+		}
+
+		buff := make([]byte, n)
+		_, err = io.ReadFull(r, buff)
+		return string(buff), err
+	}
+
+	line, err := r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+
+	return line, err
+}
+
+// consume reads messages from the connection until it is closed
+func (s *SyslogProvider) consume(c net.Conn, p event.EventPasser) {
+	defer s.wg.Done()
+
+	// a connection accepted while stopping is closed, as Stop has already closed the others
+	s.Lock()
+	if s.stop == nil {
+		s.Unlock()
+		c.Close()
+		return
+	}
+	s.conns[c] = struct{}{}
+	s.Unlock()
+
+	host := remoteHost(c.RemoteAddr())
+	r := bufio.NewReader(c)
+	for {
+		raw, err := readFrame(r)
+		if err != nil {
+			if err != io.EOF {
+				logrus.Debugf("Syslog connection from %s closed: %s", host, err)
+			}
+			break
+		}
+
+		s.handle(raw, host, p)
+	}
+
+	c.Close()
+
+	s.Lock()
+	delete(s.conns, c)
+	s.Unlock()
+}
+
+// readUDP reads messages until the connection is closed. Each datagram is a single message
+func (s *SyslogProvider) readUDP(c *net.UDPConn, p event.EventPasser, run uint64) {
+	defer s.wg.Done()
+
+	buff := make([]byte, MAX_MESSAGE_SIZE)
+	for {
+		n, addr, err := c.ReadFromUDP(buff)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			s.Fail(run, err)
+			return
+		}
+
+		s.handle(string(buff[:n]), remoteHost(addr), p)
+	}
+}
+
+// remoteHost returns the address of the sender without its port
+func remoteHost(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// handle parses the message, and passes on the events it produces. Messages without a
+// hostname are given the address they came from
+func (s *SyslogProvider) handle(raw, from string, p event.EventPasser) {
+	if strings.TrimSpace(raw) == "" {
+		return
+	}
+
+	atomic.AddUint64(&s.received, 1)
+	m, err := Parse(raw, time.Now())
+	if err != nil {
+		atomic.AddUint64(&s.malformed, 1)
+		logrus.Debug(err)
+		return
+	}
+
+	if m.Hostname == "" {
+		m.Hostname = from
+	}
+
+	if s.conf.Messages {
+		e := event.NewEvent()
+		e.Metric = float64(m.Severity)
+		e.Time = m.Timestamp
+		e.Tags.Set(TAG_HOST, m.Hostname)
+		e.Tags.Set(TAG_APP, m.AppName)
+		e.Tags.Set(TAG_FACILITY, m.FacilityName())
+		e.Tags.Set(TAG_SEVERITY, m.SeverityName())
+		p.PassEvent(e)
+	}
+
+	for _, e := range s.extractor.extract(m) {
+		p.PassEvent(e)
+	}
+}
+
+// flushEvery passes on the counts of the counter rules on each interval, and once more when stopped
+func (s *SyslogProvider) flushEvery(stop, done chan struct{}, p event.EventPasser) {
+	defer close(done)
+
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-stop:
+			s.flush(time.Now(), p)
+			return
+		case now := <-t.C:
+			s.flush(now, p)
+		}
+	}
+}
+
+func (s *SyslogProvider) flush(now time.Time, p event.EventPasser) {
+	for _, e := range s.extractor.flush(now) {
+		p.PassEvent(e)
+	}
+}
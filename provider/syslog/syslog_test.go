@@ -0,0 +1,255 @@
+package syslog
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eliothedeman/bangarang/event"
+)
+
+type testPasser struct {
+	in chan *event.Event
+}
+
+func (t *testPasser) PassEvent(e *event.Event) {
+	t.in <- e
+}
+
+func TestParse5424(t *testing.T) {
+	m, err := Parse(`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventID="1011]"] An application event`, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.FacilityName() != "local4" || m.SeverityName() != "notice" {
+		t.Fatalf("Unexpected priority %d %d", m.Facility, m.Severity)
+	}
+
+	if m.Hostname != "mymachine.example.com" || m.AppName != "evntslog" || m.Message != "An application event" {
+		t.Fatalf("Unexpected message %+v", m)
+	}
+
+	if m.Timestamp.Year() != 2003 {
+		t.Fatalf("Unexpected timestamp %s", m.Timestamp)
+	}
+}
+
+func TestParse3164(t *testing.T) {
+	now := time.Date(2015, time.December, 1, 0, 0, 0, 0, time.UTC)
+	m, err := Parse("<34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed for lonvick on /dev/pts/8", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.FacilityName() != "auth" || m.SeverityName() != "crit" {
+		t.Fatalf("Unexpected priority %d %d", m.Facility, m.Severity)
+	}
+
+	if m.Hostname != "mymachine" || m.AppName != "su" || m.Message != "'su root' failed for lonvick on /dev/pts/8" {
+		t.Fatalf("Unexpected message %+v", m)
+	}
+
+	if m.Timestamp.Year() != 2015 || m.Timestamp.Month() != time.October {
+		t.Fatalf("Unexpected timestamp %s", m.Timestamp)
+	}
+
+	// no hostname
+	m, err = Parse("<13>Oct 11 22:14:15 kernel: Out of memory", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Hostname != "" || m.AppName != "kernel" || m.Message != "Out of memory" {
+		t.Fatalf("Unexpected message %+v", m)
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	for _, raw := range []string{"no priority", "<999>1 - - - - - -", "<13>1 nope host app - - - msg", "<13>1 - host app - - [unterminated"} {
+		_, err := Parse(raw, time.Now())
+		if err == nil {
+			t.Fatalf("Expected an error for %q", raw)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	rules := []*Rule{
+		{Name: "oom", Pattern: "Out of memory: Kill process \\d+ \\((?P<process>\\w+)\\)"},
+		{Name: "latency", Pattern: "took (?P<ms>[0-9.]+)ms", Value: "ms"},
+	}
+	for _, r := range rules {
+		err := r.Compile()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	x := newExtractor(rules)
+	for _, host := range []string{"a", "a", "b"} {
+		m := &Message{Hostname: host, AppName: "kernel", Severity: 2, Message: "Out of memory: Kill process 12 (java) score 900"}
+		if len(x.extract(m)) != 0 {
+			t.Fatal("Expected the counter rule to only count")
+		}
+	}
+
+	events := x.extract(&Message{Hostname: "a", AppName: "api", Message: "request took 12.5ms"})
+	if len(events) != 1 || events[0].Metric != 12.5 || events[0].Get(TAG_RULE) != "latency" {
+		t.Fatalf("Unexpected events %+v", events)
+	}
+
+	counts := map[string]float64{}
+	for _, e := range x.flush(time.Now()) {
+		if e.Get("process") != "java" {
+			t.Fatalf("Expected the named group as a tag, got %s", e.Tags)
+		}
+
+		if e.Get(TAG_FACILITY) != "kern" || e.Get(TAG_SEVERITY) != "crit" {
+			t.Fatalf("Expected the facility and severity as tags, got %s", e.Tags)
+		}
+		counts[e.Get(TAG_HOST)] = e.Metric
+	}
+
+	if counts["a"] != 2 || counts["b"] != 1 {
+		t.Fatalf("Unexpected counts %+v", counts)
+	}
+
+	// quiet groups are sent once with a count of 0, then forgotten
+	events = x.flush(time.Now())
+	if len(events) != 2 || events[0].Metric != 0 {
+		t.Fatalf("Expected 2 empty counts, got %+v", events)
+	}
+
+	if len(x.flush(time.Now())) != 0 {
+		t.Fatal("Expected the quiet groups to be forgotten")
+	}
+}
+
+func TestInvalidRule(t *testing.T) {
+	for _, r := range []*Rule{{Pattern: "a"}, {Name: "a", Pattern: "("}, {Name: "a", Pattern: "(?P<x>a)", Value: "y"}} {
+		if r.Compile() == nil {
+			t.Fatalf("Expected an error for %+v", r)
+		}
+	}
+}
+
+func TestReadFrame(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("9 <13>1 a\nb<13>newline\n"))
+	for _, expect := range []string{"<13>1 a\nb", "<13>newline\n"} {
+		f, err := readFrame(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if f != expect {
+			t.Fatalf("Expected %q, got %q", expect, f)
+		}
+	}
+}
+
+func TestReadFrameLength(t *testing.T) {
+	for _, raw := range []string{"1234567 <13>", "12a <13>", "99999 <13>"} {
+		_, err := readFrame(bufio.NewReader(strings.NewReader(raw)))
+		if err == nil {
+			t.Errorf("Expected an error for %q", raw)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	s := NewSyslogProvider().(*SyslogProvider)
+	conf := s.ConfigStruct().(*SyslogConfig)
+	conf.Listen = "127.0.0.1:9456"
+	conf.ListenUDP = conf.Listen
+	conf.Messages = true
+	err := s.Init(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tp := &testPasser{
+		in: make(chan *event.Event),
+	}
+
+	err = s.Start(tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	for _, network := range []string{"tcp", "udp"} {
+		c, err := net.Dial(network, conf.Listen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fmt.Fprintf(c, "<11>Oct 11 22:14:15 app: over %s\n", network)
+
+		select {
+		case e := <-tp.in:
+			if e.Get(TAG_HOST) != "127.0.0.1" || e.Get(TAG_SEVERITY) != "err" || e.Metric != 3 {
+				t.Fatalf("Unexpected event %s %f", e.Tags, e.Metric)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Event was never received")
+		}
+		c.Close()
+	}
+}
+
+func TestStopFlush(t *testing.T) {
+	s := NewSyslogProvider().(*SyslogProvider)
+	conf := s.ConfigStruct().(*SyslogConfig)
+	conf.Listen = "127.0.0.1:0"
+	conf.Interval = "1h"
+	conf.Rules = []*Rule{
+		{Name: "oom", Pattern: "Out of memory"},
+	}
+	err := s.Init(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tp := &testPasser{
+		in: make(chan *event.Event, 10),
+	}
+
+	err = s.Start(tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := net.Dial("tcp", s.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	fmt.Fprintf(c, "<2>Oct 11 22:14:15 a kernel: Out of memory\n")
+	for s.Counts()[COUNT_RECEIVED] == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the count is passed on when stopped, long before the interval
+	err = s.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case e := <-tp.in:
+		if e.Get(TAG_RULE) != "oom" || e.Metric != 1 {
+			t.Fatalf("Unexpected event %s %f", e.Tags, e.Metric)
+		}
+	default:
+		t.Fatal("Expected the count to be passed on when stopped")
+	}
+
+	if len(s.conns) != 0 {
+		t.Error("Every connection should be closed", s.conns)
+	}
+}
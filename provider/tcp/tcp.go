@@ -2,6 +2,7 @@ package tcp
 
 import (
 	"net"
+	"sync"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/eliothedeman/bangarang/event"
@@ -19,15 +20,19 @@ func init() {
 type TCPProvider struct {
 	laddr    *net.TCPAddr
 	listener *net.TCPListener
+	conns    map[*net.TCPConn]struct{}
+	sync.Mutex
 }
 
 func NewTCPProvider() provider.EventProvider {
-	return &TCPProvider{}
+	return &TCPProvider{
+		conns: make(map[*net.TCPConn]struct{}),
+	}
 }
 
 // the config struct for the tcp provider
 type TCPConfig struct {
-	Listen string `json:"listen"`
+	Listen string `json:"listen" schema:"required"`
 }
 
 // Init runs the config for the provider
@@ -51,21 +56,23 @@ func (t *TCPProvider) ConfigStruct() interface{} {
 }
 
 // start accepting connections and consume each of them as they come in
-func (t *TCPProvider) Start(p event.EventPasser) {
+func (t *TCPProvider) Start(p event.EventPasser) error {
 
 	logrus.Infof("TCP Provider listening on %s", t.laddr.String())
 	// start listening on that addr
 	err := t.listen()
 	if err != nil {
-		logrus.Error(err)
-		return
+		return err
 	}
 
-	go func() {
-		// listen for ever
+	go func(l *net.TCPListener) {
+		// listen until the listener is closed
 		for {
-			c, err := t.listener.AcceptTCP()
+			c, err := l.AcceptTCP()
 			if err != nil {
+				if t.closed(l) {
+					return
+				}
 				logrus.Errorf("Cannot accept new tcp connection %s", err.Error())
 			} else {
 				// consume the connection
@@ -73,11 +80,42 @@ func (t *TCPProvider) Start(p event.EventPasser) {
 				go t.consume(c, p)
 			}
 		}
-	}()
+	}(t.listener)
+
+	return nil
+}
+
+// closed returns true if the listener has been stopped
+func (t *TCPProvider) closed(l *net.TCPListener) bool {
+	t.Lock()
+	defer t.Unlock()
+	return t.listener != l
+}
+
+// Stop closes the listener, and every connection that is still open
+func (t *TCPProvider) Stop() error {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.listener == nil {
+		return nil
+	}
+
+	err := t.listener.Close()
+	t.listener = nil
+	for c := range t.conns {
+		c.Close()
+	}
+
+	return err
 }
 
 func (t *TCPProvider) consume(c *net.TCPConn, p event.EventPasser) {
 
+	t.Lock()
+	t.conns[c] = struct{}{}
+	t.Unlock()
+
 	// create a newman connection
 	conn := newman.NewConn(c)
 	conn.SetWaiter(&newman.Backoff{})
@@ -98,6 +136,10 @@ func (t *TCPProvider) consume(c *net.TCPConn, p event.EventPasser) {
 
 	// when it is done, close the connection
 	c.Close()
+
+	t.Lock()
+	delete(t.conns, c)
+	t.Unlock()
 }
 
 func (t *TCPProvider) listen() error {
@@ -107,6 +149,8 @@ func (t *TCPProvider) listen() error {
 		return err
 	}
 
+	t.Lock()
 	t.listener = l
+	t.Unlock()
 	return nil
 }
@@ -126,3 +126,27 @@ func TestMany(t *testing.T) {
 		<-tp.in
 	}
 }
+
+func TestStop(t *testing.T) {
+	p, port := newTestTCP()
+	tp := &testPasser{
+		in: make(chan *event.Event),
+	}
+
+	for i := 0; i < 2; i++ {
+		err := p.Start(tp)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = p.Stop()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+		if err == nil {
+			t.Error("The provider should no longer be listening")
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package udp
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/eliothedeman/bangarang/event"
+	"github.com/eliothedeman/bangarang/provider"
+)
+
+const (
+	DEFAULT_MAX_PACKET_SIZE = 65535
+	DEFAULT_WORKERS         = 4
+	DEFAULT_QUEUE_SIZE      = 1024
+
+	COUNT_RECEIVED  = "received"
+	COUNT_MALFORMED = "malformed"
+	COUNT_DROPPED   = "dropped"
+)
+
+func init() {
+	provider.LoadEventProviderFactory("udp", NewUDPProvider)
+}
+
+// UDPProvider accepts one encoded event per datagram, for agents that can't hold a connection open
+type UDPProvider struct {
+	conf  *UDPConfig
+	laddr *net.UDPAddr
+	pool  *event.EncodingPool
+	conn  *net.UDPConn
+	wg    sync.WaitGroup
+	provider.Failure
+
+	received  uint64
+	malformed uint64
+	dropped   uint64
+}
+
+// UDPConfig holds the options for the udp provider
+type UDPConfig struct {
+	Listen   string `json:"listen" schema:"required"`
+	Encoding string `json:"encoding"`
+
+	// size of the socket's receive buffer in bytes. The os default if 0
+	ReadBuffer int `json:"read_buffer"`
+
+	// datagrams larger than this are truncated, and will fail to decode
+	MaxPacketSize int `json:"max_packet_size"`
+
+	// number of datagrams decoded at once
+	Workers int `json:"workers"`
+
+	// datagrams waiting to be decoded. Datagrams that arrive when the queue is full are dropped
+	QueueSize int `json:"queue_size"`
+}
+
+func NewUDPProvider() provider.EventProvider {
+	return &UDPProvider{}
+}
+
+// ConfigStruct returns a struct of config options
+func (u *UDPProvider) ConfigStruct() interface{} {
+	return &UDPConfig{
+		Encoding:      event.ENCODING_TYPE_JSON,
+		MaxPacketSize: DEFAULT_MAX_PACKET_SIZE,
+		Workers:       DEFAULT_WORKERS,
+		QueueSize:     DEFAULT_QUEUE_SIZE,
+	}
+}
+
+// Init runs the config for the provider
+func (u *UDPProvider) Init(i interface{}) error {
+	c, ok := i.(*UDPConfig)
+	if !ok {
+		return fmt.Errorf("Incorrect config type. Expecting UDPConfig not %+v", i)
+	}
+
+	enc, ok := event.EncoderFactories[c.Encoding]
+	if !ok {
+		return fmt.Errorf("Unknown encoding %s", c.Encoding)
+	}
+
+	if c.MaxPacketSize <= 0 || c.Workers <= 0 {
+		return fmt.Errorf("The max_packet_size and workers must be greater than 0")
+	}
+
+	if c.QueueSize < 0 {
+		return fmt.Errorf("The queue_size can't be negative")
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", c.Listen)
+	if err != nil {
+		return err
+	}
+
+	u.conf = c
+	u.laddr = addr
+	u.pool = event.NewEncodingPool(enc, event.DecoderFactories[c.Encoding], c.Workers)
+	return nil
+}
+
+// Start listening for datagrams, and decode them with the pool of workers
+func (u *UDPProvider) Start(p event.EventPasser) error {
+	conn, err := net.ListenUDP("udp", u.laddr)
+	if err != nil {
+		return err
+	}
+
+	if u.conf.ReadBuffer > 0 {
+		err = conn.SetReadBuffer(u.conf.ReadBuffer)
+		if err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	logrus.Infof("UDP Provider listening on %s", conn.LocalAddr())
+	u.conn = conn
+
+	packets := make(chan []byte, u.conf.QueueSize)
+	for i := 0; i < u.conf.Workers; i++ {
+		u.wg.Add(1)
+		go u.decode(packets, p)
+	}
+
+	go u.read(conn, packets, u.Begin())
+	return nil
+}
+
+// read datagrams until the connection is closed
+func (u *UDPProvider) read(conn *net.UDPConn, packets chan []byte, run uint64) {
+	defer close(packets)
+
+	buff := make([]byte, u.conf.MaxPacketSize)
+	for {
+		n, _, err := conn.ReadFromUDP(buff)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			u.Fail(run, err)
+			return
+		}
+
+		atomic.AddUint64(&u.received, 1)
+		packet := make([]byte, n)
+		copy(packet, buff[:n])
+
+		// never block the socket, drop the datagram instead
+		select {
+		case packets <- packet:
+		default:
+			atomic.AddUint64(&u.dropped, 1)
+		}
+	}
+}
+
+// decode each datagram into an event, and pass it on
+func (u *UDPProvider) decode(packets chan []byte, p event.EventPasser) {
+	defer u.wg.Done()
+	for packet := range packets {
+		e := event.NewEvent()
+		err := u.pool.Decode(packet, e)
+		if err != nil {
+			atomic.AddUint64(&u.malformed, 1)
+			logrus.Debugf("Unable to decode udp event: %s", err)
+			continue
+		}
+
+		p.PassEvent(e)
+	}
+}
+
+// Stop closes the socket, and waits for the datagrams already received to be passed on
+func (u *UDPProvider) Stop() error {
+	u.End()
+	if u.conn == nil {
+		return nil
+	}
+
+	err := u.conn.Close()
+	u.conn = nil
+	u.wg.Wait()
+	return err
+}
+
+// Counts returns the number of datagrams received, the number that could not be decoded, and
+// the number dropped because the workers could not keep up
+func (u *UDPProvider) Counts() map[string]uint64 {
+	return map[string]uint64{
+		COUNT_RECEIVED:  atomic.LoadUint64(&u.received),
+		COUNT_MALFORMED: atomic.LoadUint64(&u.malformed),
+		COUNT_DROPPED:   atomic.LoadUint64(&u.dropped),
+	}
+}
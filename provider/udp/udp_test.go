@@ -0,0 +1,132 @@
+package udp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/eliothedeman/bangarang/event"
+)
+
+var num = 2000
+
+func newTestUDP(t *testing.T) (*UDPProvider, int) {
+	num += 1
+	p := NewUDPProvider().(*UDPProvider)
+	conf := p.ConfigStruct().(*UDPConfig)
+	conf.Listen = fmt.Sprintf("127.0.0.1:%d", 9099+num)
+	err := p.Init(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, 9099 + num
+}
+
+type testPasser struct {
+	in chan *event.Event
+}
+
+func (t *testPasser) PassEvent(e *event.Event) {
+	t.in <- e
+}
+
+func send(t *testing.T, port int, buff []byte) {
+	c, err := net.Dial("udp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_, err = c.Write(buff)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSendSingle(t *testing.T) {
+	p, port := newTestUDP(t)
+	tp := &testPasser{
+		in: make(chan *event.Event),
+	}
+
+	err := p.Start(tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	e := event.NewEvent()
+	e.Tags.Set("host", "test")
+	e.Metric = 12.5
+	buff, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send(t, port, buff)
+
+	select {
+	case got := <-tp.in:
+		if got.Get("host") != "test" || got.Metric != e.Metric {
+			t.Fatalf("Unexpected event %+v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Event was never received")
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	p, port := newTestUDP(t)
+	tp := &testPasser{
+		in: make(chan *event.Event),
+	}
+
+	err := p.Start(tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	send(t, port, []byte("not an event"))
+
+	for i := 0; i < 100; i++ {
+		if p.Counts()[COUNT_MALFORMED] == 1 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("Expected 1 malformed packet, got %+v", p.Counts())
+}
+
+func TestUnknownEncoding(t *testing.T) {
+	p := NewUDPProvider()
+	conf := p.ConfigStruct().(*UDPConfig)
+	conf.Listen = "127.0.0.1:0"
+	conf.Encoding = "nope"
+	if p.Init(conf) == nil {
+		t.Fatal("Expected an error for an unknown encoding")
+	}
+}
+
+func TestStop(t *testing.T) {
+	p, port := newTestUDP(t)
+	err := p.Start(&testPasser{in: make(chan *event.Event)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the port should be free to listen on again
+	err = p.Start(&testPasser{in: make(chan *event.Event)})
+	if err != nil {
+		t.Fatalf("Unable to restart on port %d: %s", port, err)
+	}
+	p.Stop()
+}
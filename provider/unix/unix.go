@@ -0,0 +1,365 @@
+package unix
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/eliothedeman/bangarang/event"
+	"github.com/eliothedeman/bangarang/provider"
+	"github.com/eliothedeman/newman"
+)
+
+const (
+	NETWORK_STREAM   = "unix"
+	NETWORK_DATAGRAM = "unixgram"
+
+	DEFAULT_MODE            = "0660"
+	DEFAULT_MAX_PACKET_SIZE = 65535
+	DEFAULT_MAX_ENCODERS    = 4
+
+	// the longest line of json that can be read from a stream
+	MAX_LINE_SIZE = 1024 * 1024
+
+	COUNT_RECEIVED  = "received"
+	COUNT_MALFORMED = "malformed"
+)
+
+func init() {
+	provider.LoadEventProviderFactory("unix", NewUnixProvider)
+}
+
+// UnixProvider accepts events on a unix domain socket, so agents on the same host don't need a network port.
+// Streams of json have an event on each line, and streams of bin are framed the same as the tcp provider.
+// Each datagram is a single event
+type UnixProvider struct {
+	conf *UnixConfig
+	mode os.FileMode
+	pool *event.EncodingPool
+
+	listener net.Listener
+	conn     *net.UnixConn
+	conns    map[net.Conn]struct{}
+
+	// the socket file this provider created, so another provider's socket at the same path is never removed
+	file os.FileInfo
+	sync.Mutex
+	provider.Failure
+
+	received  uint64
+	malformed uint64
+}
+
+// UnixConfig holds the options for the unix provider
+type UnixConfig struct {
+	Path string `json:"path" schema:"required"`
+
+	// "unix" for a stream socket, or "unixgram" for a datagram socket
+	Network  string `json:"network"`
+	Encoding string `json:"encoding"`
+
+	// the permissions of the socket file, in octal
+	Mode        string `json:"mode"`
+	MaxEncoders int    `json:"max_encoders"`
+}
+
+func NewUnixProvider() provider.EventProvider {
+	return &UnixProvider{
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+// ConfigStruct returns a struct of config options
+func (u *UnixProvider) ConfigStruct() interface{} {
+	return &UnixConfig{
+		Network:     NETWORK_STREAM,
+		Encoding:    event.ENCODING_TYPE_JSON,
+		Mode:        DEFAULT_MODE,
+		MaxEncoders: DEFAULT_MAX_ENCODERS,
+	}
+}
+
+// Init runs the config for the provider
+func (u *UnixProvider) Init(i interface{}) error {
+	c, ok := i.(*UnixConfig)
+	if !ok {
+		return fmt.Errorf("Incorrect config type. Expecting UnixConfig not %+v", i)
+	}
+
+	if c.Path == "" {
+		return fmt.Errorf("The path of the socket must be set")
+	}
+
+	if c.Network != NETWORK_STREAM && c.Network != NETWORK_DATAGRAM {
+		return fmt.Errorf("Unknown network %s. Expecting %s or %s", c.Network, NETWORK_STREAM, NETWORK_DATAGRAM)
+	}
+
+	enc, ok := event.EncoderFactories[c.Encoding]
+	if !ok {
+		return fmt.Errorf("Unknown encoding %s", c.Encoding)
+	}
+
+	mode, err := strconv.ParseUint(c.Mode, 8, 32)
+	if err != nil || mode > 0777 {
+		return fmt.Errorf("Invalid mode %s. Expecting octal permissions such as %s", c.Mode, DEFAULT_MODE)
+	}
+
+	if c.MaxEncoders <= 0 {
+		return fmt.Errorf("The max_encoders must be greater than 0")
+	}
+
+	u.conf = c
+	u.mode = os.FileMode(mode)
+	u.pool = event.NewEncodingPool(enc, event.DecoderFactories[c.Encoding], c.MaxEncoders)
+	return nil
+}
+
+// removeStale removes a socket file left behind by a process that has exited. A socket that is
+// still being listened on is left alone
+func removeStale(path, network string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	c, err := net.Dial(network, path)
+	if err == nil {
+		c.Close()
+		return fmt.Errorf("%s is already in use", path)
+	}
+
+	return os.Remove(path)
+}
+
+// Start listening on the socket. The socket is created in a private directory and moved into place once its
+// permissions are set, so nothing can connect to it before then
+func (u *UnixProvider) Start(p event.EventPasser) error {
+	u.Lock()
+	defer u.Unlock()
+
+	err := removeStale(u.conf.Path, u.conf.Network)
+	if err != nil {
+		return err
+	}
+
+	dir, err := ioutil.TempDir(filepath.Dir(u.conf.Path), ".bangarang-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	addr := &net.UnixAddr{
+		Name: filepath.Join(dir, filepath.Base(u.conf.Path)),
+		Net:  u.conf.Network,
+	}
+
+	var closer interface {
+		Close() error
+	}
+	if u.conf.Network == NETWORK_STREAM {
+		l, err := net.ListenUnix(u.conf.Network, addr)
+		if err != nil {
+			return err
+		}
+
+		// the file is removed by closeLocked, once it has been moved
+		l.SetUnlinkOnClose(false)
+		closer = l
+	} else {
+		c, err := net.ListenUnixgram(u.conf.Network, addr)
+		if err != nil {
+			return err
+		}
+		closer = c
+	}
+
+	err = os.Chmod(addr.Name, u.mode)
+	if err == nil {
+		err = os.Rename(addr.Name, u.conf.Path)
+	}
+
+	if err == nil {
+		u.file, err = os.Stat(u.conf.Path)
+	}
+
+	if err != nil {
+		closer.Close()
+		return err
+	}
+
+	if l, ok := closer.(*net.UnixListener); ok {
+		u.listener = l
+		go u.accept(l, p)
+	} else {
+		u.conn = closer.(*net.UnixConn)
+		go u.readDatagrams(u.conn, p, u.Begin())
+	}
+
+	logrus.Infof("Unix Provider listening on %s %s", u.conf.Network, u.conf.Path)
+	return nil
+}
+
+// Stop closes the socket and every connection that is still open, and removes the socket file
+func (u *UnixProvider) Stop() error {
+	u.Lock()
+	defer u.Unlock()
+
+	u.End()
+	return u.closeLocked()
+}
+
+func (u *UnixProvider) closeLocked() error {
+	if u.listener == nil && u.conn == nil {
+		return nil
+	}
+
+	var err error
+	if u.listener != nil {
+		err = u.listener.Close()
+		u.listener = nil
+	}
+
+	if u.conn != nil {
+		err = u.conn.Close()
+		u.conn = nil
+	}
+
+	for c := range u.conns {
+		c.Close()
+	}
+
+	// only remove the socket if it is still the one this provider created
+	info, serr := os.Stat(u.conf.Path)
+	if serr == nil && os.SameFile(info, u.file) {
+		rerr := os.Remove(u.conf.Path)
+		if err == nil && rerr != nil && !os.IsNotExist(rerr) {
+			err = rerr
+		}
+	}
+	u.file = nil
+
+	return err
+}
+
+// Counts returns the number of events received, and the number that could not be decoded
+func (u *UnixProvider) Counts() map[string]uint64 {
+	return map[string]uint64{
+		COUNT_RECEIVED:  atomic.LoadUint64(&u.received),
+		COUNT_MALFORMED: atomic.LoadUint64(&u.malformed),
+	}
+}
+
+// closed returns true if the listener has been stopped
+func (u *UnixProvider) closed(l net.Listener) bool {
+	u.Lock()
+	defer u.Unlock()
+	return u.listener != l
+}
+
+func (u *UnixProvider) accept(l net.Listener, p event.EventPasser) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			if u.closed(l) {
+				return
+			}
+			logrus.Errorf("Cannot accept new unix connection %s", err.Error())
+			continue
+		}
+
+		go u.consume(c, p)
+	}
+}
+
+// consume reads events from the connection until it is closed
+func (u *UnixProvider) consume(c net.Conn, p event.EventPasser) {
+	u.Lock()
+	u.conns[c] = struct{}{}
+	u.Unlock()
+
+	if u.conf.Encoding == event.ENCODING_TYPE_BIN {
+		u.consumeFrames(c, p)
+	} else {
+		u.consumeLines(c, p)
+	}
+
+	c.Close()
+
+	u.Lock()
+	delete(u.conns, c)
+	u.Unlock()
+}
+
+// consumeFrames reads binary events framed the same as the tcp provider
+func (u *UnixProvider) consumeFrames(c net.Conn, p event.EventPasser) {
+	conn := newman.NewConn(c)
+	conn.SetWaiter(&newman.Backoff{})
+	for {
+		e := event.NewEvent()
+		err := conn.Next(e)
+		if err != nil {
+			logrus.Debugf("Unix connection closed: %s", err)
+			return
+		}
+
+		atomic.AddUint64(&u.received, 1)
+		p.PassEvent(e)
+	}
+}
+
+// consumeLines reads an event from each line
+func (u *UnixProvider) consumeLines(c net.Conn, p event.EventPasser) {
+	scanner := bufio.NewScanner(c)
+	scanner.Buffer(nil, MAX_LINE_SIZE)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			u.decode(scanner.Bytes(), p)
+		}
+	}
+}
+
+// readDatagrams reads an event from each datagram until the socket is closed
+func (u *UnixProvider) readDatagrams(c *net.UnixConn, p event.EventPasser, run uint64) {
+	buff := make([]byte, DEFAULT_MAX_PACKET_SIZE)
+	for {
+		n, _, err := c.ReadFromUnix(buff)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			u.Fail(run, err)
+			return
+		}
+
+		u.decode(buff[:n], p)
+	}
+}
+
+// decode a single event, and pass it on
+func (u *UnixProvider) decode(buff []byte, p event.EventPasser) {
+	atomic.AddUint64(&u.received, 1)
+	e := event.NewEvent()
+	err := u.pool.Decode(buff, e)
+	if err != nil {
+		atomic.AddUint64(&u.malformed, 1)
+		logrus.Debugf("Unable to decode unix event: %s", err)
+		return
+	}
+
+	p.PassEvent(e)
+}
@@ -0,0 +1,234 @@
+package unix
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eliothedeman/bangarang/event"
+	"github.com/eliothedeman/newman"
+)
+
+type testPasser struct {
+	in chan *event.Event
+}
+
+func (t *testPasser) PassEvent(e *event.Event) {
+	t.in <- e
+}
+
+func newTestUnix(t *testing.T, network, encoding string) (*UnixProvider, *testPasser, func()) {
+	dir, err := ioutil.TempDir("", "bangarang-unix")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := NewUnixProvider().(*UnixProvider)
+	conf := u.ConfigStruct().(*UnixConfig)
+	conf.Path = filepath.Join(dir, "bangarang.sock")
+	conf.Network = network
+	conf.Encoding = encoding
+	conf.Mode = "0600"
+	err = u.Init(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tp := &testPasser{
+		in: make(chan *event.Event),
+	}
+
+	err = u.Start(tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return u, tp, func() {
+		u.Stop()
+		os.RemoveAll(dir)
+	}
+}
+
+func newTestEvent(host string) *event.Event {
+	e := event.NewEvent()
+	e.Tags.Set("host", host)
+	e.Metric = 1
+	e.Time = time.Now()
+	return e
+}
+
+func receive(t *testing.T, tp *testPasser, host string) {
+	select {
+	case e := <-tp.in:
+		if e.Get("host") != host {
+			t.Fatalf("Unexpected event %s", e.Tags)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Event was never received")
+	}
+}
+
+func TestStreamJSON(t *testing.T) {
+	u, tp, done := newTestUnix(t, NETWORK_STREAM, event.ENCODING_TYPE_JSON)
+	defer done()
+
+	info, err := os.Stat(u.conf.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected the socket to have mode 0600, got %s", info.Mode())
+	}
+
+	c, err := net.Dial(NETWORK_STREAM, u.conf.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for _, host := range []string{"a", "b"} {
+		buff, _ := json.Marshal(newTestEvent(host))
+		c.Write(append(buff, '\n'))
+		receive(t, tp, host)
+	}
+}
+
+func TestStreamBin(t *testing.T) {
+	u, tp, done := newTestUnix(t, NETWORK_STREAM, event.ENCODING_TYPE_BIN)
+	defer done()
+
+	c, err := net.Dial(NETWORK_STREAM, u.conf.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn := newman.NewConn(c)
+	defer conn.Close()
+
+	err = conn.Write(newTestEvent("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	receive(t, tp, "a")
+}
+
+func TestDatagram(t *testing.T) {
+	u, tp, done := newTestUnix(t, NETWORK_DATAGRAM, event.ENCODING_TYPE_JSON)
+	defer done()
+
+	c, err := net.Dial(NETWORK_DATAGRAM, u.conf.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	c.Write([]byte("not an event"))
+	buff, _ := json.Marshal(newTestEvent("a"))
+	c.Write(buff)
+	receive(t, tp, "a")
+
+	if u.Counts()[COUNT_MALFORMED] != 1 {
+		t.Fatalf("Expected 1 malformed event, got %+v", u.Counts())
+	}
+}
+
+func TestRestart(t *testing.T) {
+	u, _, done := newTestUnix(t, NETWORK_DATAGRAM, event.ENCODING_TYPE_JSON)
+	defer done()
+
+	// a second provider can't take over a socket in use
+	other := NewUnixProvider()
+	conf := *u.conf
+	err := other.Init(&conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if other.Start(&testPasser{}) == nil {
+		t.Fatal("Expected an error for a socket that is in use")
+	}
+
+	err = u.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = os.Stat(u.conf.Path)
+	if !os.IsNotExist(err) {
+		t.Fatalf("Expected the socket file to be removed, got %v", err)
+	}
+
+	err = u.Start(&testPasser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMode(t *testing.T) {
+	u, _, done := newTestUnix(t, NETWORK_STREAM, event.ENCODING_TYPE_JSON)
+	defer done()
+
+	info, err := os.Stat(u.conf.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode()&os.ModePerm != 0600 || info.Mode()&os.ModeSocket == 0 {
+		t.Errorf("Unexpected mode %s", info.Mode())
+	}
+
+	// the private directory the socket was created in is gone
+	files, err := ioutil.ReadDir(filepath.Dir(u.conf.Path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 {
+		t.Errorf("Expected only the socket, got %d files", len(files))
+	}
+}
+
+func TestStopReplacedSocket(t *testing.T) {
+	u, _, done := newTestUnix(t, NETWORK_DATAGRAM, event.ENCODING_TYPE_JSON)
+	defer done()
+
+	// another process replaces the socket
+	err := os.Remove(u.conf.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := net.ListenUnixgram(NETWORK_DATAGRAM, &net.UnixAddr{Name: u.conf.Path, Net: NETWORK_DATAGRAM})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	err = u.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = os.Stat(u.conf.Path)
+	if err != nil {
+		t.Fatal("The socket created by someone else should be left alone", err)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	for _, c := range []*UnixConfig{
+		{Path: "/tmp/a.sock", Network: "tcp", Encoding: "json", Mode: "0660", MaxEncoders: 1},
+		{Path: "/tmp/a.sock", Network: "unix", Encoding: "nope", Mode: "0660", MaxEncoders: 1},
+		{Path: "/tmp/a.sock", Network: "unix", Encoding: "json", Mode: "rw", MaxEncoders: 1},
+		{Path: "", Network: "unix", Encoding: "json", Mode: "0660", MaxEncoders: 1},
+	} {
+		if NewUnixProvider().Init(c) == nil {
+			t.Fatalf("Expected an error for %+v", c)
+		}
+	}
+}